@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"indico-be/config"
+	"indico-be/internal/database"
+	"indico-be/internal/event"
+	"indico-be/internal/job"
+	"indico-be/internal/repository"
+	"indico-be/internal/service"
+
+	"gorm.io/gorm"
+)
+
+// app is the wiring shared by every subcommand that works on the database.
+type app struct {
+	cfg *config.Config
+	db  *database.DB
+
+	orderRepo    repository.OrderRepository
+	txRepo       repository.TransactionRepository
+	settleRepo   repository.SettlementRepository
+	jobRepo      repository.JobRepository
+	fxRepo       repository.FxRepository
+	scheduleRepo repository.ScheduleRepository
+	webhookRepo  repository.WebhookRepository
+
+	eventBus    *event.Bus
+	orderSvc    *service.OrderService
+	jobSvc      *service.JobService
+	reconSvc    *service.ReconciliationService
+	settleSvc   *service.SettlementService
+	scheduleSvc *service.ScheduleService
+	txSvc       *service.TransactionService
+	importSvc   *service.ImportService
+
+	registry *job.Registry
+}
+
+// openDB connects to the primary only, for the commands that write.
+func openDB(cfg *config.Config) (*gorm.DB, error) {
+	return database.OpenPrimary(cfg)
+}
+
+// newApp connects to the database, checks its schema and builds the
+// repositories, services and job handlers.
+func newApp(cfg *config.Config) (*app, error) {
+	// ---------- 1️⃣ Koneksi DB ----------
+	// Writes (ReduceStock, Upsert, job claims) always go to the primary;
+	// API listings and settlement reports read from the replica, if one is
+	// configured, and fall back to the primary while it is down.
+	conn, err := database.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db, reads := conn.Primary, conn.Reads
+
+	// ---------- 2️⃣ Schema ----------
+	// The schema is owned by migrations/ (`go run . migrate up`), not by the
+	// models; refuse to start against a database that is behind.
+	if err := checkSchema(db); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("schema check failed: %w", err)
+	}
+
+	a := &app{cfg: cfg, db: conn}
+
+	// ---------- 3️⃣ Repositories ----------
+	a.orderRepo = repository.NewOrderRepo(db)
+	// Settlement and reconciliation runs scan the primary: a watermark
+	// advanced past rows the replica has not received yet would skip them
+	// for good.
+	a.txRepo = repository.NewTransactionRepo(db, nil)
+	listRepo := repository.NewTransactionRepo(db, reads)
+	a.settleRepo = repository.NewSettlementRepo(db)
+	reportRepo := repository.NewSettlementRepo(reads)
+	a.jobRepo = repository.NewJobRepository(db)
+	recRepo := repository.NewReconciliationRepo(db)
+	a.fxRepo = repository.NewFxRepo(db)
+	a.scheduleRepo = repository.NewScheduleRepo(db)
+	a.webhookRepo = repository.NewWebhookRepo(db)
+	importRepo := repository.NewImportRepo(db)
+
+	// ---------- 4️⃣ Services ----------
+	a.eventBus = event.NewBus(256, 10*time.Minute)
+	a.orderSvc = service.NewOrderService(a.orderRepo)
+	a.jobSvc = service.NewJobService(a.jobRepo, a.eventBus)
+	a.reconSvc = service.NewReconciliationService(a.txRepo, a.settleRepo, recRepo)
+	a.settleSvc = service.NewSettlementService(a.txRepo, a.settleRepo, a.fxRepo, a.reconSvc, a.jobSvc)
+	a.settleSvc.SetParallelism(cfg.Settlement.Parallelism)
+	a.settleSvc.SetBatchSize(cfg.Settlement.BatchSize)
+	a.settleSvc.SetWriteChunk(cfg.Settlement.WriteChunk)
+	a.settleSvc.SetCheckpointInterval(cfg.Settlement.CheckpointInterval)
+	a.settleSvc.SetExportDir(cfg.Export.Dir)
+	a.settleSvc.SetReportRepo(reportRepo)
+	a.scheduleSvc = service.NewScheduleService(a.scheduleRepo)
+	a.txSvc = service.NewTransactionService(listRepo)
+	a.importSvc = service.NewImportService(a.txSvc, importRepo, a.jobSvc, a.jobRepo)
+	a.importSvc.SetExportDir(cfg.Export.Dir)
+
+	// ---------- 5️⃣ Job handlers ----------
+	a.registry = job.NewRegistry()
+	job.RegisterDefaults(a.registry, a.settleSvc, a.reconSvc, a.importSvc)
+
+	return a, nil
+}
+
+// Close releases the database connections.
+func (a *app) Close() error {
+	return a.db.Close()
+}
+
+// workerPool runs up to workers jobs of this process at once.
+func (a *app) workerPool(workers int) *job.WorkerPool {
+	return job.NewWorkerPool(workers, a.registry, a.jobSvc)
+}
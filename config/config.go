@@ -1,36 +1,349 @@
+// Package config loads the service configuration: built-in defaults, then
+// an optional YAML or TOML file, then environment variables, each layer
+// overriding the one before. Every setting has a file key (its conf tag,
+// dotted by section) and most an environment variable (its env tag).
 package config
 
 import (
-	"os"
+	"fmt"
+	"net"
+	"net/url"
+	"runtime"
 	"strconv"
+	"strings"
+	"time"
+
+	"indico-be/internal/job"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 type Config struct {
-	Port        string
-	MySQLDSN    string
-	WorkerCount int
+	HTTP       HTTP       `conf:"http"`
+	DB         DB         `conf:"db"`
+	Worker     Worker     `conf:"worker"`
+	Settlement Settlement `conf:"settlement"`
+	Export     Export     `conf:"export"`
+	// Timezone is the process's local zone and the zone of DATETIME values
+	// exchanged with MySQL.
+	Timezone string `conf:"timezone" env:"TIMEZONE"`
+	// AdminToken protects /admin; empty leaves it open (local development).
+	AdminToken string `conf:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+type HTTP struct {
+	Port              int           `conf:"port" env:"PORT"`
+	ReadHeaderTimeout time.Duration `conf:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	// ReadTimeout and WriteTimeout bound a whole request; 0 leaves large
+	// uploads and event streams unbounded.
+	ReadTimeout  time.Duration `conf:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout time.Duration `conf:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout  time.Duration `conf:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	// ShutdownTimeout is how long in-flight requests get on shutdown.
+	ShutdownTimeout time.Duration `conf:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT"`
+	// DrainDelay is how long /readyz reports draining before the API stops
+	// taking requests, so load balancers stop routing here first.
+	DrainDelay time.Duration `conf:"drain_delay" env:"HTTP_DRAIN_DELAY"`
+	// AllowedOrigins may open job event WebSockets from a browser, besides
+	// pages served by the API's own host; "*" allows any origin.
+	AllowedOrigins []string `conf:"allowed_origins" env:"HTTP_ALLOWED_ORIGINS"`
+}
+
+type DB struct {
+	Host     string `conf:"host" env:"MYSQL_HOST"`
+	Port     int    `conf:"port" env:"MYSQL_PORT"`
+	User     string `conf:"user" env:"MYSQL_USER"`
+	Password string `conf:"password" env:"MYSQL_PASSWORD" secret:"true"`
+	Name     string `conf:"name" env:"MYSQL_DB"`
+	// Params are extra DSN parameters, e.g. MYSQL_PARAMS=charset=utf8mb4.
+	Params map[string]string `conf:"params" env:"MYSQL_PARAMS"`
+
+	MaxOpenConns    int           `conf:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `conf:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `conf:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `conf:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+
+	DialTimeout  time.Duration `conf:"dial_timeout" env:"DB_DIAL_TIMEOUT"`
+	ReadTimeout  time.Duration `conf:"read_timeout" env:"DB_READ_TIMEOUT"`
+	WriteTimeout time.Duration `conf:"write_timeout" env:"DB_WRITE_TIMEOUT"`
+
+	// Replica, when its Host is set, serves the transaction listing and
+	// settlement reports of the API.
+	Replica Replica `conf:"replica"`
 }
 
-func Load() *Config {
-	port := os.Getenv("PORT")
-	user := os.Getenv("MYSQL_USER")
-	pass := os.Getenv("MYSQL_PASSWORD")
-	host := os.Getenv("MYSQL_HOST")
-	db := os.Getenv("MYSQL_DB")
-	dsn := user + ":" + pass + "@tcp(" + host + ":3306)/" + db + "?parseTime=true"
+// Replica is a read-only copy of the database. Without a User it logs in
+// with the primary's credentials; the name, params, timeouts and connection
+// lifetimes of DB apply to both.
+type Replica struct {
+	Host     string `conf:"host" env:"MYSQL_REPLICA_HOST"`
+	Port     int    `conf:"port" env:"MYSQL_REPLICA_PORT"`
+	User     string `conf:"user" env:"MYSQL_REPLICA_USER"`
+	Password string `conf:"password" env:"MYSQL_REPLICA_PASSWORD" secret:"true"`
 
-	workers, _ := strconv.Atoi(os.Getenv("WORKER_COUNT"))
+	MaxOpenConns int `conf:"max_open_conns" env:"DB_REPLICA_MAX_OPEN_CONNS"`
+	MaxIdleConns int `conf:"max_idle_conns" env:"DB_REPLICA_MAX_IDLE_CONNS"`
+	// CheckInterval is how often the replica is pinged; reads go to the
+	// primary while it does not answer.
+	CheckInterval time.Duration `conf:"check_interval" env:"DB_REPLICA_CHECK_INTERVAL"`
+}
+
+type Worker struct {
+	// Count is the number of workers a process running jobs starts with;
+	// only the API-only "serve" role may run none.
+	Count int `conf:"count" env:"WORKER_COUNT"`
+	// TenantWeights gives submitters a larger share of their queue,
+	// e.g. QUEUE_TENANT_WEIGHTS=ops=3,partner-a=2.
+	TenantWeights map[string]int `conf:"tenant_weights" env:"QUEUE_TENANT_WEIGHTS"`
+	// ShutdownTimeout is how long running jobs get to checkpoint on
+	// SIGINT/SIGTERM; jobs still running then are left to their lease.
+	ShutdownTimeout time.Duration `conf:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+type Settlement struct {
+	// Parallelism is how many day shards of one settlement job are read
+	// concurrently.
+	Parallelism int `conf:"parallelism" env:"SETTLEMENT_PARALLELISM"`
+	// BatchSize is how many transactions one read of a shard returns.
+	BatchSize int `conf:"batch_size" env:"SETTLEMENT_BATCH_SIZE"`
+	// WriteChunk is how many settlement rows one insert writes.
+	WriteChunk int `conf:"write_chunk" env:"SETTLEMENT_WRITE_CHUNK"`
+	// CheckpointInterval is how often a run checkpoints while reading
+	// transactions; 0 checkpoints after every batch.
+	CheckpointInterval time.Duration `conf:"checkpoint_interval" env:"SETTLEMENT_CHECKPOINT_INTERVAL"`
+}
 
+type Export struct {
+	// Dir holds settlement CSVs and import rejects, served under
+	// /jobs/downloads.
+	Dir string `conf:"dir" env:"EXPORT_DIR"`
+}
+
+// Default is the configuration used for anything not set by the file or
+// the environment.
+func Default() *Config {
 	return &Config{
-		Port:        port,
-		MySQLDSN:    dsn,
-		WorkerCount: workers,
+		HTTP: HTTP{
+			Port:              8080,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   5 * time.Second,
+			DrainDelay:        5 * time.Second,
+		},
+		DB: DB{
+			Host:            "localhost",
+			Port:            3306,
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			DialTimeout:     5 * time.Second,
+			Replica: Replica{
+				Port:          3306,
+				MaxOpenConns:  25,
+				MaxIdleConns:  10,
+				CheckInterval: 5 * time.Second,
+			},
+		},
+		Worker: Worker{
+			Count:           defaultWorkerCount(),
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Settlement: Settlement{
+			Parallelism:        4,
+			BatchSize:          5000,
+			WriteChunk:         500,
+			CheckpointInterval: 5 * time.Second,
+		},
+		Export:   Export{Dir: "public/downloads"},
+		Timezone: "UTC",
+	}
+}
+
+// defaultWorkerCount is used when WORKER_COUNT is unset: one worker per CPU,
+// but at least two so one long job never blocks everything else.
+func defaultWorkerCount() int {
+	if n := runtime.NumCPU(); n > 2 {
+		return n
+	}
+	return 2
+}
+
+// Load reads path (if not empty) over the defaults, applies the
+// environment and validates the result.
+func Load(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Read is Load without the validation.
+func Read(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.applyFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Location is the parsed Timezone; UTC if it does not parse.
+func (c *Config) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// MySQLDSN is the go-sql-driver DSN of the primary database.
+func (c *Config) MySQLDSN() string {
+	return c.dsn(c.DB.Host, c.DB.Port, c.DB.User, c.DB.Password)
+}
+
+// ReplicaDSN is the DSN of the replica, or "" when none is configured.
+func (c *Config) ReplicaDSN() string {
+	r := c.DB.Replica
+	if r.Host == "" {
+		return ""
 	}
+	user, pass := r.User, r.Password
+	if user == "" {
+		user, pass = c.DB.User, c.DB.Password
+	}
+	return c.dsn(r.Host, r.Port, user, pass)
 }
 
-func getEnv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+func (c *Config) dsn(host string, port int, user, pass string) string {
+	m := mysql.NewConfig()
+	m.User = user
+	m.Passwd = pass
+	m.Net = "tcp"
+	m.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	m.DBName = c.DB.Name
+	m.ParseTime = true
+	m.Loc = c.Location()
+	m.Timeout = c.DB.DialTimeout
+	m.ReadTimeout = c.DB.ReadTimeout
+	m.WriteTimeout = c.DB.WriteTimeout
+	if len(c.DB.Params) > 0 {
+		m.Params = make(map[string]string, len(c.DB.Params))
+		for k, v := range c.DB.Params {
+			m.Params[k] = v
+		}
+	}
+	return m.FormatDSN()
+}
+
+// Error lists every problem found in a configuration.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate reports every invalid setting at once, by file key and
+// environment variable.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.HTTP.Port < 1 || c.HTTP.Port > 65535 {
+		add("http.port (PORT) must be between 1 and 65535, got %d", c.HTTP.Port)
+	}
+	for _, origin := range c.HTTP.AllowedOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || u.Path != "") {
+			add("http.allowed_origins (HTTP_ALLOWED_ORIGINS): %q is not an origin like https://dashboard.example.com", origin)
+		}
+	}
+
+	if c.DB.Host == "" {
+		add("db.host (MYSQL_HOST) is required")
+	}
+	if c.DB.Port < 1 || c.DB.Port > 65535 {
+		add("db.port (MYSQL_PORT) must be between 1 and 65535, got %d", c.DB.Port)
+	}
+	if c.DB.User == "" {
+		add("db.user (MYSQL_USER) is required")
+	}
+	if c.DB.Name == "" {
+		add("db.name (MYSQL_DB) is required")
+	}
+	if c.DB.MaxOpenConns < 0 {
+		add("db.max_open_conns (DB_MAX_OPEN_CONNS) must not be negative; 0 means unlimited")
+	}
+	if c.DB.MaxIdleConns < 0 {
+		add("db.max_idle_conns (DB_MAX_IDLE_CONNS) must not be negative")
+	}
+	if c.DB.MaxOpenConns > 0 && c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		add("db.max_idle_conns (%d) must not exceed db.max_open_conns (%d)", c.DB.MaxIdleConns, c.DB.MaxOpenConns)
+	}
+
+	if r := c.DB.Replica; r.Host != "" {
+		if r.Port < 1 || r.Port > 65535 {
+			add("db.replica.port (MYSQL_REPLICA_PORT) must be between 1 and 65535, got %d", r.Port)
+		}
+		if r.MaxOpenConns < 0 || r.MaxIdleConns < 0 {
+			add("db.replica.max_open_conns and db.replica.max_idle_conns must not be negative")
+		}
+		if r.MaxOpenConns > 0 && r.MaxIdleConns > r.MaxOpenConns {
+			add("db.replica.max_idle_conns (%d) must not exceed db.replica.max_open_conns (%d)", r.MaxIdleConns, r.MaxOpenConns)
+		}
+		if r.CheckInterval <= 0 {
+			add("db.replica.check_interval (DB_REPLICA_CHECK_INTERVAL) must be positive")
+		}
+	}
+
+	if c.Worker.Count < 0 || c.Worker.Count > job.MaxWorkers {
+		add("worker.count (WORKER_COUNT) must be between 0 and %d, got %d", job.MaxWorkers, c.Worker.Count)
+	}
+	for tenant, w := range c.Worker.TenantWeights {
+		if w <= 0 {
+			add("worker.tenant_weights: weight of %q must be positive, got %d", tenant, w)
+		}
+	}
+
+	if c.Settlement.Parallelism < 1 {
+		add("settlement.parallelism (SETTLEMENT_PARALLELISM) must be at least 1, got %d", c.Settlement.Parallelism)
+	}
+	if c.Settlement.BatchSize < 1 {
+		add("settlement.batch_size (SETTLEMENT_BATCH_SIZE) must be at least 1, got %d", c.Settlement.BatchSize)
+	}
+	if c.Settlement.WriteChunk < 1 {
+		add("settlement.write_chunk (SETTLEMENT_WRITE_CHUNK) must be at least 1, got %d", c.Settlement.WriteChunk)
+	}
+	if c.Settlement.CheckpointInterval < 0 {
+		add("settlement.checkpoint_interval (SETTLEMENT_CHECKPOINT_INTERVAL) must not be negative, got %s", c.Settlement.CheckpointInterval)
+	}
+
+	if strings.TrimSpace(c.Export.Dir) == "" {
+		add("export.dir (EXPORT_DIR) is required")
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil || c.Timezone == "" {
+		add("timezone (TIMEZONE) %q is not an IANA zone name", c.Timezone)
+	}
+
+	walk(c, func(key string, f field) {
+		if d, ok := f.value.Interface().(time.Duration); ok && d < 0 {
+			add("%s must not be negative, got %s", f.describe(key), d)
+		}
+	})
+
+	if len(problems) > 0 {
+		return &Error{Problems: problems}
 	}
-	return fallback
+	return nil
 }
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the value of a secret that is set.
+const redacted = "<redacted>"
+
+// Print writes the configuration as "yaml" or "toml", in a form Load
+// accepts back, with secrets redacted.
+func (c *Config) Print(w io.Writer, format string) error {
+	tree := map[string]interface{}{}
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{"": doc}
+	tables := map[string]map[string]interface{}{"": tree}
+
+	walk(c, func(key string, f field) {
+		// Create the sections of key on first use, in declaration order.
+		parts := strings.Split(key, ".")
+		parent := ""
+		for _, part := range parts[:len(parts)-1] {
+			path := strings.TrimPrefix(parent+"."+part, ".")
+			if _, seen := sections[path]; !seen {
+				sections[path] = &yaml.Node{Kind: yaml.MappingNode}
+				sections[parent].Content = append(sections[parent].Content, scalar(part), sections[path])
+				tables[path] = map[string]interface{}{}
+				tables[parent][part] = tables[path]
+			}
+			parent = path
+		}
+
+		name, val := parts[len(parts)-1], printable(f)
+		tables[parent][name] = val
+		var vn yaml.Node
+		if err := vn.Encode(val); err == nil {
+			sections[parent].Content = append(sections[parent].Content, scalar(name), &vn)
+		}
+	})
+
+	switch format {
+	case "yaml", "":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "toml":
+		return toml.NewEncoder(w).Encode(tree)
+	}
+	return fmt.Errorf("unknown format %q, want yaml or toml", format)
+}
+
+func scalar(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: s}
+}
+
+// printable is f's value as it would be written in a config file.
+func printable(f field) interface{} {
+	v := f.value
+	if f.secret && !v.IsZero() {
+		return redacted
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Map {
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = iter.Value().Interface()
+		}
+		return m
+	}
+	return v.Interface()
+}
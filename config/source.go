@@ -0,0 +1,231 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is one setting of Config.
+type field struct {
+	value  reflect.Value
+	env    string
+	secret bool
+}
+
+func (f field) describe(key string) string {
+	if f.env == "" {
+		return key
+	}
+	return key + " (" + f.env + ")"
+}
+
+// walk calls fn for every setting of c, in declaration order, with its
+// dotted file key.
+func walk(c *Config, fn func(key string, f field)) {
+	var visit func(v reflect.Value, prefix string)
+	visit = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			key := prefix + sf.Tag.Get("conf")
+			if sf.Type.Kind() == reflect.Struct {
+				visit(v.Field(i), key+".")
+				continue
+			}
+			fn(key, field{value: v.Field(i), env: sf.Tag.Get("env"), secret: sf.Tag.Get("secret") == "true"})
+		}
+	}
+	visit(reflect.ValueOf(c).Elem(), "")
+}
+
+// applyEnv overrides every setting whose environment variable is set.
+func (c *Config) applyEnv() error {
+	var problems []string
+	walk(c, func(key string, f field) {
+		if f.env == "" {
+			return
+		}
+		raw := strings.TrimSpace(os.Getenv(f.env))
+		if raw == "" {
+			return
+		}
+		if err := set(f.value, raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.env, err))
+		}
+	})
+	if len(problems) > 0 {
+		return &Error{Problems: problems}
+	}
+	return nil
+}
+
+// applyFile overrides the settings present in a .yaml/.yml or .toml file.
+// Unknown keys are errors, so a typo does not silently keep a default.
+func (c *Config) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed reading config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed parsing %s: %w", path, err)
+	}
+
+	fields := map[string]field{}
+	sections := map[string]bool{}
+	walk(c, func(key string, f field) {
+		fields[key] = f
+		if i := strings.LastIndex(key, "."); i > 0 {
+			sections[key[:i]] = true
+		}
+	})
+
+	var problems []string
+	var apply func(m map[string]interface{}, prefix string)
+	apply = func(m map[string]interface{}, prefix string) {
+		for k, v := range m {
+			key := prefix + k
+			if sections[key] {
+				switch sub := v.(type) {
+				case map[string]interface{}:
+					apply(sub, key+".")
+				case nil:
+				default:
+					problems = append(problems, fmt.Sprintf("%s: %s must be a section, got %v", path, key, v))
+				}
+				continue
+			}
+			f, ok := fields[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown key %s", path, key))
+				continue
+			}
+			if err := setFromFile(f.value, v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s: %v", path, key, err))
+			}
+		}
+	}
+	apply(raw, "")
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &Error{Problems: problems}
+	}
+	return nil
+}
+
+// setFromFile stores a decoded YAML/TOML value, parsed like the
+// environment variable of the same setting would be.
+func setFromFile(v reflect.Value, raw interface{}) error {
+	if raw == nil {
+		return nil
+	}
+	if list, ok := raw.([]interface{}); ok && v.Kind() == reflect.Slice {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return set(v, strings.Join(items, ","))
+	}
+	if v.Kind() != reflect.Map {
+		return set(v, fmt.Sprint(raw))
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("want a table of key: value, got %v", raw)
+	}
+	out := reflect.MakeMapWithSize(v.Type(), len(m))
+	for k, item := range m {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := set(elem, fmt.Sprint(item)); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		out.SetMapIndex(reflect.ValueOf(k), elem)
+	}
+	v.Set(out)
+	return nil
+}
+
+// set parses raw into v. Lists are written as a,b and maps as k=v,k=v.
+func set(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, want e.g. 30s or 5m", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		out := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(raw, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := set(elem, item); err != nil {
+				return err
+			}
+			out = reflect.Append(out, elem)
+		}
+		v.Set(out)
+	case reflect.Map:
+		out := reflect.MakeMap(v.Type())
+		for _, pair := range strings.Split(raw, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			k, item, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid entry %q, want key=value", pair)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := set(elem, strings.TrimSpace(item)); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			out.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)), elem)
+		}
+		v.Set(out)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
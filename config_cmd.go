@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"indico-be/config"
+)
+
+// runConfig implements `go run . config print`. The configuration is
+// printed even when it is invalid, followed by what is wrong with it.
+func runConfig(path string, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: config print [-format yaml|toml]")
+	}
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	format := fs.String("format", "yaml", "yaml or toml")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := config.Read(path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Print(os.Stdout, *format); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
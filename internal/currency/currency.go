@@ -0,0 +1,113 @@
+// Package currency knows the minor units of the currencies we settle in and
+// converts amounts between them without going through float64.
+package currency
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	IDR = "IDR"
+	SGD = "SGD"
+	USD = "USD"
+)
+
+// Default is used for rows written before amounts carried a currency.
+const Default = IDR
+
+// exponents are the ISO 4217 minor units: an amount of 12345 with exponent 2
+// is 123.45 in major units.
+var exponents = map[string]int{
+	IDR: 2,
+	SGD: 2,
+	USD: 2,
+}
+
+// Supported reports whether code is a currency we accept.
+func Supported(code string) bool {
+	_, ok := exponents[code]
+	return ok
+}
+
+// Exponent returns the number of minor-unit digits of code.
+func Exponent(code string) (int, error) {
+	e, ok := exponents[code]
+	if !ok {
+		return 0, fmt.Errorf("unsupported currency %q", code)
+	}
+	return e, nil
+}
+
+// Format renders a minor-unit amount in major units, e.g. 12345 USD → "123.45".
+func Format(amount int64, code string) string {
+	e, err := Exponent(code)
+	if err != nil || e == 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := fmt.Sprintf("%0*d", e+1, amount)
+	return sign + digits[:len(digits)-e] + "." + digits[len(digits)-e:]
+}
+
+// ParseRate parses a decimal rate such as "0.0000643" exactly.
+func ParseRate(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid fx rate %q", s)
+	}
+	return r, nil
+}
+
+// Convert turns a minor-unit amount in `from` into minor units of `to` using
+// rate (units of `to` per one unit of `from`). The result is rounded half away
+// from zero.
+func Convert(amount int64, from, to string, rate *big.Rat) (int64, error) {
+	fe, err := Exponent(from)
+	if err != nil {
+		return 0, err
+	}
+	te, err := Exponent(to)
+	if err != nil {
+		return 0, err
+	}
+
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), rate)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(te-fe))), nil)
+	if te > fe {
+		v.Mul(v, new(big.Rat).SetInt(scale))
+	} else if te < fe {
+		v.Quo(v, new(big.Rat).SetInt(scale))
+	}
+
+	return roundHalfAway(v), nil
+}
+
+func roundHalfAway(v *big.Rat) int64 {
+	num := new(big.Int).Set(v.Num())
+	den := v.Denom()
+	neg := num.Sign() < 0
+	num.Abs(num)
+
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if neg {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,226 @@
+// Package database opens the primary MySQL database and, when configured,
+// a read replica that lag-tolerant reads go to while it is reachable.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"indico-be/config"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// DB is the primary and the handle for reads.
+type DB struct {
+	// Primary takes every write and every read that must see them.
+	Primary *gorm.DB
+	// Reads goes to the replica while it is healthy and to the primary
+	// otherwise; it is Primary when no replica is configured.
+	Reads *gorm.DB
+
+	replica *replicaPool
+}
+
+// OpenPrimary connects to the primary with the configured pool limits.
+func OpenPrimary(cfg *config.Config) (*gorm.DB, error) {
+	db, err := gorm.Open(mysql.Open(cfg.MySQLDSN()), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to db: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.DB.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.DB.ConnMaxIdleTime)
+	return db, nil
+}
+
+// Open connects to the primary and to the replica, if any. A replica that
+// is down at startup is not an error: reads use the primary until it
+// answers.
+func Open(cfg *config.Config) (*DB, error) {
+	primary, err := OpenPrimary(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d := &DB{Primary: primary, Reads: primary}
+
+	dsn := cfg.ReplicaDSN()
+	if dsn == "" {
+		return d, nil
+	}
+	primarySQL, err := primary.DB()
+	if err != nil {
+		return nil, err
+	}
+	// sql.Open only validates the DSN; connections are made on use.
+	replicaSQL, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replica DSN: %w", err)
+	}
+	replicaSQL.SetMaxOpenConns(cfg.DB.Replica.MaxOpenConns)
+	replicaSQL.SetMaxIdleConns(cfg.DB.Replica.MaxIdleConns)
+	replicaSQL.SetConnMaxLifetime(cfg.DB.ConnMaxLifetime)
+	replicaSQL.SetConnMaxIdleTime(cfg.DB.ConnMaxIdleTime)
+
+	d.replica = newReplicaPool(primarySQL, replicaSQL, cfg.DB.Replica.Host, cfg.DB.Replica.CheckInterval)
+	d.Reads, err = gorm.Open(mysql.New(mysql.Config{
+		Conn: d.replica,
+		// Same server version as the primary; skip asking a replica that
+		// may be down.
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	if err != nil {
+		d.replica.close()
+		return nil, fmt.Errorf("cannot set up replica reads: %w", err)
+	}
+	return d, nil
+}
+
+// ReplicaHealthy reports whether a replica is configured and whether reads
+// currently go to it.
+func (d *DB) ReplicaHealthy() (configured, healthy bool) {
+	if d.replica == nil {
+		return false, false
+	}
+	return true, d.replica.healthy.Load()
+}
+
+// Close stops checking the replica and closes both pools.
+func (d *DB) Close() error {
+	if d.replica != nil {
+		d.replica.close()
+	}
+	sqlDB, err := d.Primary.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// replicaPool is a gorm connection pool that sends statements to the
+// replica while it is healthy and to the primary otherwise. A statement
+// that fails because the replica cannot be reached is retried on the
+// primary, and the replica is skipped until its next successful ping.
+type replicaPool struct {
+	primary *sql.DB
+	replica *sql.DB
+	name    string
+	healthy atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newReplicaPool(primary, replica *sql.DB, name string, interval time.Duration) *replicaPool {
+	p := &replicaPool{
+		primary: primary,
+		replica: replica,
+		name:    name,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	p.check(interval)
+	go p.watch(interval)
+	return p
+}
+
+func (p *replicaPool) watch(interval time.Duration) {
+	defer close(p.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.check(interval)
+		}
+	}
+}
+
+// check pings the replica and logs when it goes down or comes back.
+func (p *replicaPool) check(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := p.replica.PingContext(ctx)
+	p.setHealthy(err == nil, err)
+}
+
+func (p *replicaPool) setHealthy(ok bool, cause error) {
+	if p.healthy.Swap(ok) == ok {
+		return
+	}
+	if ok {
+		log.Printf("[db] replica %s is back, reads go to it", p.name)
+	} else {
+		log.Printf("[db] replica %s unavailable (%v), reads go to the primary", p.name, cause)
+	}
+}
+
+func (p *replicaPool) close() {
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+		p.replica.Close()
+	})
+}
+
+// unreachable tells connection failures, worth retrying on the primary,
+// from errors of the statement itself.
+func unreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysqldriver.ErrInvalidConn) ||
+		errors.As(err, &netErr)
+}
+
+// run tries fn on the replica when it is healthy, then on the primary.
+func run[T any](p *replicaPool, fn func(db *sql.DB) (T, error)) (T, error) {
+	if p.healthy.Load() {
+		v, err := fn(p.replica)
+		if !unreachable(err) {
+			return v, err
+		}
+		p.setHealthy(false, err)
+	}
+	return fn(p.primary)
+}
+
+func (p *replicaPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return run(p, func(db *sql.DB) (*sql.Stmt, error) { return db.PrepareContext(ctx, query) })
+}
+
+func (p *replicaPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return run(p, func(db *sql.DB) (sql.Result, error) { return db.ExecContext(ctx, query, args...) })
+}
+
+func (p *replicaPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return run(p, func(db *sql.DB) (*sql.Rows, error) { return db.QueryContext(ctx, query, args...) })
+}
+
+func (p *replicaPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	row, _ := run(p, func(db *sql.DB) (*sql.Row, error) {
+		row := db.QueryRowContext(ctx, query, args...)
+		return row, row.Err()
+	})
+	return row
+}
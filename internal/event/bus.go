@@ -0,0 +1,194 @@
+// Package event is an in-process pub/sub for job lifecycle events. It keeps a
+// short history per job so clients can resume a stream with Last-Event-ID.
+package event
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	TypeProgress  = "progress"
+	TypeStatus    = "status"
+	TypeCompleted = "completed"
+)
+
+// Event is one step in a job's life. ID increases per job starting at 1.
+type Event struct {
+	ID         uint64    `json:"id"`
+	JobID      string    `json:"job_id"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status,omitempty"`
+	Phase      string    `json:"phase,omitempty"`
+	Processed  int64     `json:"processed"`
+	Total      int64     `json:"total"`
+	Progress   int       `json:"progress"`
+	EtaSeconds int64     `json:"eta_seconds,omitempty"`
+	ResultPath string    `json:"result_path,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Terminal reports whether no further events follow for the job.
+func (e Event) Terminal() bool {
+	return e.Type == TypeCompleted
+}
+
+type stream struct {
+	nextID   uint64
+	history  []Event
+	subs     map[chan Event]struct{}
+	closedAt time.Time
+}
+
+// Bus fans events out to subscribers. Slow subscribers are dropped rather
+// than blocking publishers; they can reconnect and resume from history.
+type Bus struct {
+	// instance tells this bus's event IDs from those another process, or an
+	// earlier run of this one, issued for the same job.
+	instance string
+	mu       sync.Mutex
+	streams  map[string]*stream
+	global   map[chan Event]struct{}
+	history  int
+	ttl      time.Duration
+}
+
+func NewBus(history int, ttl time.Duration) *Bus {
+	var tag [4]byte
+	_, _ = rand.Read(tag[:])
+	return &Bus{
+		instance: hex.EncodeToString(tag[:]),
+		streams:  make(map[string]*stream),
+		global:   make(map[chan Event]struct{}),
+		history:  history,
+		ttl:      ttl,
+	}
+}
+
+// Instance identifies the bus among the processes serving a job's events.
+// Clients resuming a stream need it alongside the event ID, since IDs only
+// count the events this bus published.
+func (b *Bus) Instance() string {
+	return b.instance
+}
+
+// Publish stamps e with the next ID of its job and delivers it.
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.prune()
+	st := b.stream(e.JobID)
+	st.nextID++
+	e.ID = st.nextID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	st.history = append(st.history, e)
+	if len(st.history) > b.history {
+		st.history = st.history[len(st.history)-b.history:]
+	}
+
+	for ch := range st.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(st.subs, ch)
+			close(ch)
+		}
+	}
+
+	for ch := range b.global {
+		select {
+		case ch <- e:
+		default:
+			log.Printf("[event] global subscriber full, dropped event %d of job %s", e.ID, e.JobID)
+		}
+	}
+
+	if e.Terminal() {
+		st.closedAt = time.Now()
+		for ch := range st.subs {
+			delete(st.subs, ch)
+			close(ch)
+		}
+	}
+	return e
+}
+
+// Subscribe returns the buffered events after lastID and a channel for new
+// ones. The channel is closed after the terminal event, when the subscriber
+// falls behind, or when cancel is called. done is true if the job already
+// finished, in which case the channel is nil.
+func (b *Bus) Subscribe(jobID string, lastID uint64) (replay []Event, ch <-chan Event, done bool, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.stream(jobID)
+	for _, e := range st.history {
+		if e.ID > lastID {
+			replay = append(replay, e)
+		}
+	}
+	if !st.closedAt.IsZero() {
+		return replay, nil, true, func() {}
+	}
+
+	c := make(chan Event, 64)
+	st.subs[c] = struct{}{}
+	return replay, c, false, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := st.subs[c]; ok {
+			delete(st.subs, c)
+			close(c)
+		}
+		// Jobs running on another replica never publish here.
+		if len(st.subs) == 0 && len(st.history) == 0 {
+			delete(b.streams, jobID)
+		}
+	}
+}
+
+// SubscribeAll receives every job's events from now on. Unlike per-job
+// subscribers it is never dropped; events are only skipped (and logged) while
+// its buffer is full.
+func (b *Bus) SubscribeAll(buffer int) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, buffer)
+	b.global[c] = struct{}{}
+	return c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.global[c]; ok {
+			delete(b.global, c)
+			close(c)
+		}
+	}
+}
+
+func (b *Bus) stream(jobID string) *stream {
+	st, ok := b.streams[jobID]
+	if !ok {
+		st = &stream{subs: make(map[chan Event]struct{})}
+		b.streams[jobID] = st
+	}
+	return st
+}
+
+// prune forgets jobs that finished more than ttl ago. Callers hold b.mu.
+func (b *Bus) prune() {
+	cutoff := time.Now().Add(-b.ttl)
+	for id, st := range b.streams {
+		if !st.closedAt.IsZero() && st.closedAt.Before(cutoff) {
+			delete(b.streams, id)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"indico-be/internal/job"
+
+	"github.com/gin-gonic/gin"
+)
+
+type scaleReq struct {
+	Count *int `json:"count" binding:"required"`
+}
+
+// RegisterAdminRoutes exposes this instance's worker pool. Behind a load
+// balancer, address the instance directly; the response names it.
+func RegisterAdminRoutes(r *gin.Engine, q *job.JobQueue, token string) {
+	admin := r.Group("/admin", adminAuth(token))
+	{
+		admin.GET("/workers", listWorkers(q))
+		admin.PUT("/workers", scaleWorkers(q))
+		admin.POST("/workers/pause", pauseWorkers(q))
+		admin.POST("/workers/resume", resumeWorkers(q))
+	}
+}
+
+// adminAuth requires "Authorization: Bearer <token>" when a token is set.
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			return
+		}
+		got := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		}
+	}
+}
+
+func listWorkers(q *job.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, q.Workers())
+	}
+}
+
+func scaleWorkers(q *job.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scaleReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := q.Scale(*req.Count); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, q.Workers())
+	}
+}
+
+func pauseWorkers(q *job.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q.Pause()
+		c.JSON(http.StatusOK, q.Workers())
+	}
+}
+
+func resumeWorkers(q *job.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q.Resume()
+		c.JSON(http.StatusOK, q.Workers())
+	}
+}
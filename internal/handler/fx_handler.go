@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"indico-be/internal/currency"
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fxRateReq struct {
+	BaseCurrency  string `json:"base_currency" binding:"required"`
+	QuoteCurrency string `json:"quote_currency" binding:"required"`
+	Rate          string `json:"rate" binding:"required"`
+	EffectiveFrom string `json:"effective_from" binding:"required"`
+}
+
+type merchantCurrencyReq struct {
+	SettlementCurrency string `json:"settlement_currency" binding:"required"`
+}
+
+func RegisterFxRoutes(r *gin.Engine, repo repository.FxRepository) {
+	r.GET("/fx-rates", listFxRates(repo))
+	r.POST("/fx-rates", createFxRate(repo))
+	r.PUT("/merchants/:id/settlement-currency", setMerchantCurrency(repo))
+}
+
+func listFxRates(repo repository.FxRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rates, err := repo.ListRates(c.Request.Context(),
+			strings.ToUpper(c.Query("base")), strings.ToUpper(c.Query("quote")))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rates)
+	}
+}
+
+func createFxRate(repo repository.FxRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req fxRateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		base, quote := strings.ToUpper(req.BaseCurrency), strings.ToUpper(req.QuoteCurrency)
+		if !currency.Supported(base) || !currency.Supported(quote) || base == quote {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported currency pair"})
+			return
+		}
+		if _, err := currency.ParseRate(req.Rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		effective, err := models.ParseDate(req.EffectiveFrom)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid effective_from date"})
+			return
+		}
+
+		rate := &models.FxRate{
+			BaseCurrency:  base,
+			QuoteCurrency: quote,
+			Rate:          req.Rate,
+			EffectiveFrom: effective,
+		}
+		if err := repo.CreateRate(c.Request.Context(), rate); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, rate)
+	}
+}
+
+func setMerchantCurrency(repo repository.FxRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		var req merchantCurrencyReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cur := strings.ToUpper(req.SettlementCurrency)
+		if !currency.Supported(cur) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported currency"})
+			return
+		}
+
+		if err := repo.SetSettlementCurrency(c.Request.Context(), id, cur); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"merchant_id": id, "settlement_currency": cur})
+	}
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"indico-be/internal/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterHealthRoutes exposes the probes for orchestrators: /healthz only
+// says the process answers, /livez and /readyz run the checks of h and
+// return 503 with the failing ones.
+func RegisterHealthRoutes(r *gin.Engine, h *health.Checker) {
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+	})
+	r.GET("/livez", probe(h.Liveness))
+	r.GET("/readyz", probe(h.Readiness))
+}
+
+func probe(run func(ctx context.Context) health.Report) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rep := run(c.Request.Context())
+		code := http.StatusOK
+		if !rep.OK() {
+			code = http.StatusServiceUnavailable
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(code, rep)
+	}
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"indico-be/internal/job"
+	"indico-be/internal/models"
+	"indico-be/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxImportUpload bounds one uploaded transaction file.
+const maxImportUpload = 512 << 20
+
+func RegisterImportRoutes(r *gin.Engine, q *job.JobQueue, svc *service.ImportService) {
+	r.POST("/imports/transactions", uploadTransactionImport(q, svc))
+	r.GET("/imports/transactions/:sha256", getTransactionImport(svc))
+}
+
+// uploadTransactionImport stores a multipart "file" and submits a
+// transaction_import job for it. Uploading the same content again returns
+// the job of the first upload.
+func uploadTransactionImport(q *job.JobQueue, svc *service.ImportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportUpload)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+
+		format := strings.ToLower(c.PostForm("format"))
+		if format == "" {
+			switch strings.ToLower(filepath.Ext(fh.Filename)) {
+			case ".csv":
+				format = service.ImportCSV
+			case ".ndjson", ".jsonl":
+				format = service.ImportNDJSON
+			}
+		}
+		if format != service.ImportCSV && format != service.ImportNDJSON {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+			return
+		}
+
+		opts := service.ImportOptions{
+			Format:       format,
+			Filename:     filepath.Base(fh.Filename),
+			PaidAtLayout: c.PostForm("paid_at_layout"),
+		}
+		if cols := c.PostForm("columns"); cols != "" {
+			if err := json.Unmarshal([]byte(cols), &opts.Columns); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "columns must be a JSON object of field to column"})
+				return
+			}
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		if opts.SHA256, err = svc.Store(f, format); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		payload, err := json.Marshal(job.TransactionImportPayload{ImportOptions: opts})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		queue := c.PostForm("queue")
+		if queue == "" {
+			queue = job.QueueBackfill
+		}
+		rec, err := q.NewRecord(job.EnqueueRequest{
+			Type:    job.TypeTransactionImport,
+			Payload: payload,
+			Queue:   queue,
+			Tenant:  tenantOf(c),
+		})
+		if err != nil {
+			enqueueFailed(c, err)
+			return
+		}
+
+		// The import and its job are stored together, so a registration
+		// never outlives a failed submit.
+		imp, existing, err := svc.Register(c.Request.Context(), &models.TransactionImport{
+			SHA256:   opts.SHA256,
+			Filename: opts.Filename,
+			Format:   format,
+		}, rec)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if existing {
+			c.JSON(http.StatusOK, gin.H{"job_id": imp.JobID, "sha256": imp.SHA256, "duplicate": true})
+			return
+		}
+		q.Submitted(rec)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"job_id": rec.ID,
+			"type":   job.TypeTransactionImport,
+			"status": "QUEUED",
+			"sha256": opts.SHA256,
+		})
+	}
+}
+
+func getTransactionImport(svc *service.ImportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		imp, err := svc.Get(c.Request.Context(), strings.ToLower(c.Param("sha256")))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "import not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, imp)
+	}
+}
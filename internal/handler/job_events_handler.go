@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"indico-be/internal/event"
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	eventsHeartbeat = 15 * time.Second
+	// eventsPoll is how often a followed job's record is re-read. Workers
+	// in another process (`serve` + `worker`) publish on their own bus, so
+	// the record is the only progress this process sees of them.
+	eventsPoll = 2 * time.Second
+)
+
+// eventsUpgrader accepts WebSockets opened from the API's own host, from
+// the allowed origins ("*" for any) and from non-browser clients, which send
+// no Origin.
+func eventsUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	anyOrigin := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, o := range allowedOrigins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.ToLower(o)] = true
+	}
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" || anyOrigin || allowed[strings.ToLower(origin)] {
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		},
+	}
+}
+
+// snapshotEvent describes a job from its stored record. It carries no ID, so
+// it never moves a client's Last-Event-ID.
+func snapshotEvent(rec *models.Job) event.Event {
+	e := event.Event{
+		JobID:      rec.ID,
+		Type:       event.TypeStatus,
+		Status:     string(rec.Status),
+		Phase:      rec.Phase,
+		Processed:  rec.Processed,
+		Total:      rec.Total,
+		Progress:   rec.Progress,
+		EtaSeconds: rec.EtaSeconds,
+		ResultPath: rec.ResultPath,
+		Time:       rec.UpdatedAt,
+	}
+	if rec.Status.IsTerminal() {
+		e.Type = event.TypeCompleted
+	}
+	return e
+}
+
+// jobState is what a client has been told about a job; a stored record
+// that differs from it is sent as a snapshot.
+type jobState struct {
+	status    string
+	phase     string
+	progress  int
+	processed int64
+}
+
+func (s *jobState) apply(e event.Event) {
+	if e.Status != "" {
+		s.status = e.Status
+	}
+	if e.Phase != "" {
+		s.phase = e.Phase
+	}
+	if e.Type == event.TypeProgress || e.Processed > 0 || e.Progress > 0 {
+		s.progress, s.processed = e.Progress, e.Processed
+	}
+}
+
+func stateOf(rec *models.Job) jobState {
+	return jobState{string(rec.Status), rec.Phase, rec.Progress, rec.Processed}
+}
+
+// followJob feeds emit with a job's events until it completes or ctx ends:
+// first the buffered events after lastID, then live ones. The record is
+// also re-read every eventsPoll and sent as a snapshot when it changed, so
+// jobs running in another process are followed too.
+func followJob(ctx context.Context, repo repository.JobRepository, bus *event.Bus, jobID string, lastID uint64,
+	emit func(e event.Event) error, ping func() error) error {
+
+	rec, err := repo.GetByID(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	replay, ch, done, cancel := bus.Subscribe(jobID, lastID)
+	defer cancel()
+
+	var seen jobState
+	send := func(e event.Event) error {
+		seen.apply(e)
+		return emit(e)
+	}
+	sendSnapshot := func(rec *models.Job) (bool, error) {
+		seen = stateOf(rec)
+		snap := snapshotEvent(rec)
+		return snap.Terminal(), emit(snap)
+	}
+
+	if lastID == 0 && len(replay) == 0 {
+		if last, err := sendSnapshot(rec); err != nil || last {
+			return err
+		}
+	}
+	for _, e := range replay {
+		if err := send(e); err != nil || e.Terminal() {
+			return err
+		}
+	}
+	if done {
+		if rec, err = repo.GetByID(ctx, jobID); err == nil {
+			return emit(snapshotEvent(rec))
+		}
+		return err
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(eventsPoll)
+	defer poll.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-ch:
+			if !ok {
+				// Dropped for falling behind; the client resumes with its
+				// last event id.
+				return nil
+			}
+			if err := send(e); err != nil || e.Terminal() {
+				return err
+			}
+		case <-poll.C:
+			rec, err := repo.GetByID(ctx, jobID)
+			if err != nil || stateOf(rec) == seen {
+				continue
+			}
+			if last, err := sendSnapshot(rec); err != nil || last {
+				return err
+			}
+		case <-heartbeat.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// eventID is the ID a client resumes from: the event's ID qualified by the
+// bus that issued it.
+func eventID(bus *event.Bus, e event.Event) string {
+	return bus.Instance() + "-" + strconv.FormatUint(e.ID, 10)
+}
+
+// lastEventID is the event a reconnecting client last saw. IDs another
+// process issued (a replica, or this one before a restart) count different
+// events, so they are ignored and the client starts over from a snapshot.
+func lastEventID(c *gin.Context, bus *event.Bus) uint64 {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("last_event_id")
+	}
+	instance, seq, ok := strings.Cut(raw, "-")
+	if !ok || instance != bus.Instance() {
+		return 0
+	}
+	id, _ := strconv.ParseUint(seq, 10, 64)
+	return id
+}
+
+// streamJobEvents streams progress, status transitions and completion as
+// Server-Sent Events.
+func streamJobEvents(repo repository.JobRepository, bus *event.Bus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := repo.GetByID(c.Request.Context(), id); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		w := c.Writer
+		emit := func(e event.Event) error {
+			msg := sse.Event{Event: e.Type, Data: e}
+			if e.ID > 0 {
+				msg.Id = eventID(bus, e)
+			}
+			if err := sse.Encode(w, msg); err != nil {
+				return err
+			}
+			w.Flush()
+			return nil
+		}
+		ping := func() error {
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return err
+			}
+			w.Flush()
+			return nil
+		}
+
+		_ = followJob(c.Request.Context(), repo, bus, id, lastEventID(c, bus), emit, ping)
+	}
+}
+
+// wsEvent is an event as sent over a WebSocket, with the ID to resume from.
+type wsEvent struct {
+	event.Event
+	LastEventID string `json:"last_event_id,omitempty"`
+}
+
+// jobEventsWebSocket sends the same events as JSON messages over a
+// WebSocket. Resume with ?last_event_id= set to the last message's
+// last_event_id.
+func jobEventsWebSocket(repo repository.JobRepository, bus *event.Bus, upgrader *websocket.Upgrader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := repo.GetByID(c.Request.Context(), id); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// The client only ever closes; reading notices that.
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		emit := func(e event.Event) error {
+			msg := wsEvent{Event: e}
+			if e.ID > 0 {
+				msg.LastEventID = eventID(bus, e)
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			return conn.WriteJSON(msg)
+		}
+		ping := func() error {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+		}
+
+		if err := followJob(ctx, repo, bus, id, lastEventID(c, bus), emit, ping); err == nil {
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "done"), time.Now().Add(time.Second))
+		}
+	}
+}
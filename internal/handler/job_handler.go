@@ -1,30 +1,80 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"path/filepath"
+	"strconv"
 
+	"indico-be/internal/event"
 	"indico-be/internal/job"
 	"indico-be/internal/repository"
+	"indico-be/internal/service"
+	"indico-be/internal/webhook"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type settlementReq struct {
-	From string `json:"from" binding:"required"` 
-	To   string `json:"to" binding:"required"`
+	From            string `json:"from" binding:"required"`
+	To              string `json:"to" binding:"required"`
+	ConvertCurrency bool   `json:"convert_currency"`
+	Mode            string `json:"mode"`
+	Stream          string `json:"stream"`
+	CallbackURL     string `json:"callback_url" binding:"omitempty,url"`
+	CallbackSecret  string `json:"callback_secret"`
+	Queue           string `json:"queue"`
 }
 
-func RegisterJobRoutes(r *gin.Engine, q *job.JobQueue, repo repository.JobRepository) {
+// jobReq submits a job of any registered type.
+type jobReq struct {
+	Type           string          `json:"type" binding:"required"`
+	Payload        json.RawMessage `json:"payload"`
+	CallbackURL    string          `json:"callback_url" binding:"omitempty,url"`
+	CallbackSecret string          `json:"callback_secret"`
+	Queue          string          `json:"queue"`
+}
+
+// RegisterJobRoutes serves job results from exportDir under
+// /jobs/downloads. allowedOrigins may open event WebSockets from a browser.
+func RegisterJobRoutes(r *gin.Engine, q *job.JobQueue, repo repository.JobRepository, recon *service.ReconciliationService, bus *event.Bus, exportDir string, allowedOrigins []string) {
 	jobs := r.Group("/jobs")
 	{
-		jobs.POST("/settlement", submitJob(q))
+		jobs.POST("", submitJob(q))
+		jobs.POST("/settlement", submitSettlementJob(q))
+		jobs.GET("/types", jobTypes(q))
+		jobs.GET("/queues", queueStats(q))
 		jobs.GET("/:id", getJobStatus(q))
 		jobs.POST("/:id/cancel", cancelJob(q))
-		jobs.GET("/downloads/:filename", serveCSV())
+		jobs.GET("/:id/reconciliation", getReconciliation(repo, recon))
+		jobs.GET("/:id/events", streamJobEvents(repo, bus))
+		jobs.GET("/:id/ws", jobEventsWebSocket(repo, bus, eventsUpgrader(allowedOrigins)))
+		jobs.GET("/downloads/:filename", serveCSV(exportDir))
 	}
 }
 
 func submitJob(q *job.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req jobReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		enqueue(c, q, job.EnqueueRequest{
+			Type:           req.Type,
+			Payload:        req.Payload,
+			CallbackURL:    req.CallbackURL,
+			CallbackSecret: req.CallbackSecret,
+			Queue:          req.Queue,
+		})
+	}
+}
+
+// submitSettlementJob is the settlement-only shorthand of POST /jobs.
+func submitSettlementJob(q *job.JobQueue) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req settlementReq
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,16 +82,102 @@ func submitJob(q *job.JobQueue) gin.HandlerFunc {
 			return
 		}
 
-		jobID, err := q.Enqueue(req.From, req.To)
+		opts := service.RunOptions{ConvertCurrency: req.ConvertCurrency, Mode: req.Mode, Stream: req.Stream}
+		jr, err := job.SettlementJob(req.From, req.To, opts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		jr.CallbackURL = req.CallbackURL
+		jr.CallbackSecret = req.CallbackSecret
+		jr.Queue = req.Queue
+		enqueue(c, q, jr)
+	}
+}
 
-		c.JSON(http.StatusAccepted, gin.H{
-			"job_id": jobID,
-			"status": "QUEUED",
-		})
+func enqueue(c *gin.Context, q *job.JobQueue, req job.EnqueueRequest) {
+	// Callers that do not bring their own secret get one generated;
+	// it is only ever returned here.
+	if req.CallbackURL != "" {
+		if err := webhook.CheckURL(req.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "callback_url: " + err.Error()})
+			return
+		}
+	}
+	generated := req.CallbackURL != "" && req.CallbackSecret == ""
+	if generated {
+		req.CallbackSecret = webhook.NewSecret()
+	}
+
+	jobID, ok := submit(c, q, req)
+	if !ok {
+		return
+	}
+
+	resp := gin.H{
+		"job_id": jobID,
+		"type":   req.Type,
+		"status": "QUEUED",
+	}
+	if generated {
+		resp["callback_secret"] = req.CallbackSecret
+	}
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// submit enqueues req for the calling tenant. On failure it writes the
+// error response and reports false.
+func submit(c *gin.Context, q *job.JobQueue, req job.EnqueueRequest) (string, bool) {
+	req.Tenant = tenantOf(c)
+
+	jobID, err := q.Enqueue(req)
+	if err != nil {
+		enqueueFailed(c, err)
+		return "", false
+	}
+	return jobID, true
+}
+
+// enqueueFailed answers a request whose job could not be enqueued.
+func enqueueFailed(c *gin.Context, err error) {
+	var (
+		full       *job.QueueFullError
+		payloadErr *job.PayloadError
+	)
+	switch {
+	case errors.As(err, &full):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(full.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, job.ErrUnknownQueue), errors.Is(err, job.ErrUnknownType), errors.As(err, &payloadErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// tenantOf identifies the submitter for fair dispatch: the X-Tenant-ID
+// header, or the client address when it is missing.
+func tenantOf(c *gin.Context) string {
+	if t := c.GetHeader("X-Tenant-ID"); t != "" {
+		return t
+	}
+	return c.ClientIP()
+}
+
+func jobTypes(q *job.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"types": q.Types()})
+	}
+}
+
+func queueStats(q *job.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := q.Stats()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
 	}
 }
 
@@ -61,17 +197,46 @@ func cancelJob(q *job.JobQueue) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		if err := q.Cancel(id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			case errors.Is(err, repository.ErrInvalidTransition):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"job_id": id, "status": "CANCELLING"})
 	}
 }
 
-func serveCSV() gin.HandlerFunc {
+func getReconciliation(repo repository.JobRepository, recon *service.ReconciliationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		rec, err := repo.GetByID(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		rows, err := recon.List(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"job_id":            id,
+			"status":            rec.Status,
+			"discrepancy_count": len(rows),
+			"discrepancies":     rows,
+		})
+	}
+}
+
+func serveCSV(dir string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		filename := c.Param("filename")
-		filePath := "public/downloads/" + filename
+		filePath := filepath.Join(dir, filepath.Base(filename))
 		c.File(filePath)
 	}
 }
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"indico-be/internal/models"
+	"indico-be/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type scheduleReq struct {
+	Name            string `json:"name" binding:"required"`
+	CronExpr        string `json:"cron_expr" binding:"required"`
+	Timezone        string `json:"timezone"`
+	FromOffsetDays  *int   `json:"from_offset_days"`
+	ToOffsetDays    *int   `json:"to_offset_days"`
+	ConvertCurrency bool   `json:"convert_currency"`
+	Mode            string `json:"mode"`
+	Enabled         *bool  `json:"enabled"`
+}
+
+// apply copies the request onto sch; omitted offsets default to "yesterday".
+func (r scheduleReq) apply(sch *models.Schedule) {
+	sch.Name = r.Name
+	sch.CronExpr = r.CronExpr
+	sch.Timezone = r.Timezone
+	sch.FromOffsetDays, sch.ToOffsetDays = -1, -1
+	if r.FromOffsetDays != nil {
+		sch.FromOffsetDays = *r.FromOffsetDays
+	}
+	if r.ToOffsetDays != nil {
+		sch.ToOffsetDays = *r.ToOffsetDays
+	}
+	sch.ConvertCurrency = r.ConvertCurrency
+	sch.Mode = r.Mode
+	sch.Enabled = r.Enabled == nil || *r.Enabled
+}
+
+func RegisterScheduleRoutes(r *gin.Engine, svc *service.ScheduleService) {
+	schedules := r.Group("/schedules")
+	{
+		schedules.GET("", listSchedules(svc))
+		schedules.POST("", createSchedule(svc))
+		schedules.GET("/:id", getSchedule(svc))
+		schedules.PUT("/:id", updateSchedule(svc))
+		schedules.DELETE("/:id", deleteSchedule(svc))
+	}
+}
+
+func listSchedules(svc *service.ScheduleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := svc.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rows)
+	}
+}
+
+func createSchedule(svc *service.ScheduleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scheduleReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sch := &models.Schedule{}
+		req.apply(sch)
+		if err := svc.Create(c.Request.Context(), sch); err != nil {
+			writeScheduleError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, sch)
+	}
+}
+
+func getSchedule(svc *service.ScheduleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		sch, err := svc.Get(c.Request.Context(), id)
+		if err != nil {
+			writeScheduleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, sch)
+	}
+}
+
+func updateSchedule(svc *service.ScheduleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		var req scheduleReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sch, err := svc.Get(c.Request.Context(), id)
+		if err != nil {
+			writeScheduleError(c, err)
+			return
+		}
+		req.apply(sch)
+		if err := svc.Update(c.Request.Context(), sch); err != nil {
+			writeScheduleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, sch)
+	}
+}
+
+func deleteSchedule(svc *service.ScheduleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		if err := svc.Delete(c.Request.Context(), id); err != nil {
+			writeScheduleError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func writeScheduleError(c *gin.Context, err error) {
+	var vErr *service.ValidationError
+	switch {
+	case errors.As(err, &vErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"indico-be/internal/models"
+	"indico-be/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterSettlementRoutes(r *gin.Engine, svc *service.SettlementService) {
+	settlements := r.Group("/settlements")
+	{
+		settlements.GET("", listSettlements(svc))
+		settlements.GET("/versions", listSettlementVersions(svc))
+		settlements.GET("/diff", diffSettlementRuns(svc))
+		settlements.GET("/watermarks", listWatermarks(svc))
+	}
+}
+
+// listSettlements returns the current versions for a period, or every row of
+// one run when run_id is given.
+func listSettlements(svc *service.SettlementService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if runID := c.Query("run_id"); runID != "" {
+			rows, err := svc.ListRun(c.Request.Context(), runID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, rows)
+			return
+		}
+
+		from, err := models.ParseDate(c.Query("from"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+		to, err := models.ParseDate(c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+		var merchantID uint64
+		if m := c.Query("merchant_id"); m != "" {
+			if merchantID, err = strconv.ParseUint(m, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid merchant_id"})
+				return
+			}
+		}
+
+		rows, err := svc.ListCurrent(c.Request.Context(), merchantID, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rows)
+	}
+}
+
+func listSettlementVersions(svc *service.SettlementService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		merchantID, err := strconv.ParseUint(c.Query("merchant_id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid merchant_id"})
+			return
+		}
+		date, err := models.ParseDate(c.Query("date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date"})
+			return
+		}
+
+		rows, err := svc.ListVersions(c.Request.Context(), merchantID, date)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rows)
+	}
+}
+
+func diffSettlementRuns(svc *service.SettlementService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runA, runB := c.Query("run_a"), c.Query("run_b")
+		if runA == "" || runB == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "run_a and run_b are required"})
+			return
+		}
+
+		diffs, err := svc.DiffRuns(c.Request.Context(), runA, runB)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"run_a":   runA,
+			"run_b":   runB,
+			"changes": len(diffs),
+			"diff":    diffs,
+		})
+	}
+}
+
+func listWatermarks(svc *service.SettlementService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := svc.ListWatermarks(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rows)
+	}
+}
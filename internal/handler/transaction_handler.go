@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+	"indico-be/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIngestBody bounds one POST /transactions request.
+const maxIngestBody = 64 << 20
+
+func RegisterTransactionRoutes(r *gin.Engine, svc *service.TransactionService) {
+	r.POST("/transactions", ingestTransactions(svc))
+	r.GET("/transactions", listTransactions(svc))
+}
+
+// ingestTransactions takes one JSON transaction, or one per line with
+// Content-Type application/x-ndjson.
+func ingestTransactions(svc *service.TransactionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBody)
+		ctx := c.Request.Context()
+
+		mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+		if mediaType == "application/x-ndjson" || mediaType == "application/jsonl" {
+			res, err := svc.IngestNDJSON(ctx, c.Request.Body)
+			if err != nil {
+				status := http.StatusInternalServerError
+				var ve *service.ValidationError
+				if errors.As(err, &ve) {
+					status = http.StatusBadRequest
+				}
+				c.JSON(status, gin.H{"error": err.Error(), "result": res})
+				return
+			}
+			c.JSON(http.StatusOK, res)
+			return
+		}
+
+		var t models.Transaction
+		if err := c.ShouldBindJSON(&t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := svc.Ingest(ctx, []models.Transaction{t}, 1)
+		switch {
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		case res.Rejected > 0:
+			c.JSON(http.StatusBadRequest, gin.H{"error": res.Rejects[0].Error})
+		case res.Inserted == 0:
+			c.JSON(http.StatusOK, res)
+		default:
+			c.JSON(http.StatusCreated, res)
+		}
+	}
+}
+
+// listTransactions pages in (paid_at, id) order; pass the returned next
+// cursor as after_paid_at and after_id to get the following page.
+func listTransactions(svc *service.TransactionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			f   repository.TransactionFilter
+			err error
+		)
+		if m := c.Query("merchant_id"); m != "" {
+			if f.MerchantID, err = strconv.ParseUint(m, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid merchant_id"})
+				return
+			}
+		}
+		if f.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+			return
+		}
+		if f.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+			return
+		}
+		if a := c.Query("after_paid_at"); a != "" {
+			if f.After.PaidAt, err = time.Parse(time.RFC3339Nano, a); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after_paid_at"})
+				return
+			}
+			if f.After.ID, err = strconv.ParseUint(c.Query("after_id"), 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after_id"})
+				return
+			}
+		}
+		if l := c.Query("limit"); l != "" {
+			if f.Limit, err = strconv.Atoi(l); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+		}
+		f.Status = c.Query("status")
+
+		txs, err := svc.List(c.Request.Context(), f)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		resp := gin.H{"transactions": txs}
+		if len(txs) > 0 {
+			last := txs[len(txs)-1]
+			resp["next"] = repository.Cursor{PaidAt: last.PaidAt, ID: last.ID}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// parseTimeParam accepts RFC 3339 or a plain date; a plain date used as an
+// upper bound covers the whole day.
+func parseTimeParam(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	t, err := models.ParseDate(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return t, nil
+}
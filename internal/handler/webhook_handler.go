@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+	"indico-be/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type webhookReq struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+func RegisterWebhookRoutes(r *gin.Engine, repo repository.WebhookRepository) {
+	webhooks := r.Group("/webhooks")
+	{
+		webhooks.GET("", listWebhooks(repo))
+		webhooks.POST("", createWebhook(repo))
+		webhooks.DELETE("/:id", deleteWebhook(repo))
+		webhooks.GET("/deliveries", listDeliveries(repo))
+		webhooks.GET("/deliveries/:id", getDelivery(repo))
+		webhooks.POST("/deliveries/:id/redeliver", redeliver(repo))
+	}
+}
+
+func listWebhooks(repo repository.WebhookRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subs, err := repo.ListSubscriptions(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range subs {
+			subs[i].Secret = ""
+		}
+		c.JSON(http.StatusOK, subs)
+	}
+}
+
+// createWebhook returns the signing secret once; it is not shown again.
+func createWebhook(repo repository.WebhookRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req webhookReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := webhook.CheckURL(req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url: " + err.Error()})
+			return
+		}
+		for i, ev := range req.Events {
+			req.Events[i] = strings.ToUpper(strings.TrimSpace(ev))
+		}
+		secret := req.Secret
+		if secret == "" {
+			secret = webhook.NewSecret()
+		}
+
+		sub := &models.WebhookSubscription{
+			URL:    req.URL,
+			Secret: secret,
+			Events: strings.Join(req.Events, ","),
+			Active: true,
+		}
+		if err := repo.CreateSubscription(c.Request.Context(), sub); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, sub)
+	}
+}
+
+func deleteWebhook(repo repository.WebhookRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		if err := repo.DeleteSubscription(c.Request.Context(), id); err != nil {
+			writeWebhookError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func listDeliveries(repo repository.WebhookRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := repo.ListDeliveries(c.Request.Context(), c.Query("job_id"), strings.ToUpper(c.Query("status")), 100)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rows)
+	}
+}
+
+func getDelivery(repo repository.WebhookRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		d, err := repo.GetDelivery(c.Request.Context(), id)
+		if err != nil {
+			writeWebhookError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+func redeliver(repo repository.WebhookRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		if err := repo.Redeliver(c.Request.Context(), id); err != nil {
+			writeWebhookError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"delivery_id": id, "status": models.DeliveryPending})
+	}
+}
+
+func writeWebhookError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,147 @@
+// Package health runs the liveness and readiness checks behind /livez and
+// /readyz.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDraining = "draining"
+)
+
+// CheckFunc checks one dependency. detail is shown in the report either
+// way, e.g. "4 workers" or "replica down, reads on primary".
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Report is the body of /livez and /readyz. Status is ok only when every
+// check passed.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// OK reports whether the probe should succeed.
+func (r Report) OK() bool { return r.Status == StatusOK }
+
+// Checker holds the registered checks and whether the process is draining.
+type Checker struct {
+	timeout  time.Duration
+	live     []check
+	ready    []check
+	draining atomic.Bool
+}
+
+// NewChecker fails any check that takes longer than timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Live adds a liveness check. It should only fail when restarting the
+// process would help, never because a dependency is down.
+func (c *Checker) Live(name string, fn CheckFunc) {
+	c.live = append(c.live, check{name, fn})
+}
+
+// Ready adds a readiness check.
+func (c *Checker) Ready(name string, fn CheckFunc) {
+	c.ready = append(c.ready, check{name, fn})
+}
+
+// Drain makes readiness fail from now on; called when shutdown starts.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Liveness runs the liveness checks. Draining does not affect it, so the
+// process is not killed while it finishes its jobs.
+func (c *Checker) Liveness(ctx context.Context) Report {
+	return c.run(ctx, c.live)
+}
+
+// Readiness runs the readiness checks; while draining the report is
+// draining whatever they say.
+func (c *Checker) Readiness(ctx context.Context) Report {
+	rep := c.run(ctx, c.ready)
+	if c.Draining() {
+		rep.Status = StatusDraining
+	}
+	return rep
+}
+
+// run runs checks concurrently, each bounded by the timeout.
+func (c *Checker) run(ctx context.Context, checks []check) Report {
+	rep := Report{Status: StatusOK, Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			rep.Checks[i] = c.runOne(ctx, ch)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	for _, r := range rep.Checks {
+		if r.Status != StatusOK {
+			rep.Status = StatusFail
+		}
+	}
+	return rep
+}
+
+// runOne gives up on a check that outlives the timeout, e.g. one stuck on
+// a lock, and leaves it to finish in the background.
+func (c *Checker) runOne(ctx context.Context, ch check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		detail, err := ch.fn(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	res := Result{Name: ch.name, Status: StatusOK}
+	select {
+	case o := <-done:
+		res.Detail = o.detail
+		if o.err != nil {
+			res.Status = StatusFail
+			res.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		res.Status = StatusFail
+		res.Error = "timed out after " + c.timeout.String()
+	}
+	res.DurationMs = time.Since(start).Milliseconds()
+	return res
+}
@@ -0,0 +1,192 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+	"indico-be/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// ClaimConfig tunes how workers take jobs from the shared job table.
+type ClaimConfig struct {
+	// Owner identifies this instance on the jobs it holds.
+	Owner string
+	// Lease is how long a job stays held without a heartbeat; workers
+	// renew it every Lease/3.
+	Lease time.Duration
+	// Poll is how often idle workers look for jobs enqueued elsewhere.
+	Poll time.Duration
+	// MaxAttempts fails a job whose owners kept dying instead of claiming
+	// it forever, and bounds how often a retryable failure is retried.
+	MaxAttempts int
+	// RetryDelay is how long a job that failed with a RetryableError waits
+	// before it can be claimed again, times the attempts so far.
+	RetryDelay time.Duration
+}
+
+// DefaultClaimConfig holds a job for 30s between heartbeats.
+func DefaultClaimConfig() ClaimConfig {
+	return ClaimConfig{
+		Owner:       InstanceID(),
+		Lease:       30 * time.Second,
+		Poll:        2 * time.Second,
+		MaxAttempts: 3,
+		RetryDelay:  30 * time.Second,
+	}
+}
+
+// InstanceID names this process uniquely among the replicas.
+func InstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+}
+
+// claimer hands workers jobs claimed from the database, so every instance
+// behind the load balancer drains the same queues.
+type claimer struct {
+	cfg    ClaimConfig
+	repo   repository.JobRepository
+	jobs   *service.JobService
+	picker *fairPicker
+	wake   chan struct{}
+	closed chan struct{}
+
+	mu sync.Mutex
+	// resumed is closed while claiming is allowed and replaced on pause.
+	resumed chan struct{}
+	paused  bool
+}
+
+func newClaimer(cfg ClaimConfig, repo repository.JobRepository, jobs *service.JobService, weights map[string]int) *claimer {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &claimer{
+		cfg:     cfg,
+		repo:    repo,
+		jobs:    jobs,
+		picker:  newFairPicker(weights),
+		wake:    make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		resumed: resumed,
+	}
+}
+
+// pause stops handing out jobs; running ones carry on.
+func (c *claimer) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+	}
+}
+
+func (c *claimer) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		c.paused = false
+		close(c.resumed)
+	}
+}
+
+func (c *claimer) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+func (c *claimer) gate() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed
+}
+
+// notify wakes an idle worker after a local enqueue instead of waiting for
+// the next poll.
+func (c *claimer) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next blocks until it claims a job. It returns false once the claimer is
+// closed or stop is closed.
+func (c *claimer) next(stop <-chan struct{}) (*Job, bool) {
+	for {
+		select {
+		case <-c.closed:
+			return nil, false
+		case <-stop:
+			return nil, false
+		case <-c.gate():
+		}
+		// Pause may have raced with the wait above.
+		if c.isPaused() {
+			continue
+		}
+
+		j, err := c.claim(context.Background())
+		if err != nil {
+			log.Printf("[claimer] gagal mengambil job: %v", err)
+		}
+		if j != nil {
+			return j, true
+		}
+
+		select {
+		case <-c.closed:
+			return nil, false
+		case <-stop:
+			return nil, false
+		case <-c.wake:
+		case <-time.After(c.cfg.Poll):
+		}
+	}
+}
+
+// claim tries the fairest claimable job first and falls back to the others
+// when another instance wins it.
+func (c *claimer) claim(ctx context.Context) (*Job, error) {
+	heads, err := c.repo.ListClaimable(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for len(heads) > 0 {
+		i := c.picker.pick(heads)
+		rec := heads[i]
+		heads = append(heads[:i], heads[i+1:]...)
+
+		won, err := c.jobs.Claim(ctx, rec.ID, c.cfg.Owner, time.Now().Add(c.cfg.Lease))
+		if err != nil {
+			return nil, err
+		}
+		if !won {
+			continue
+		}
+		if rec.Status == models.JobRunning {
+			log.Printf("[claimer] reclaimed job %s from %s (attempt %d)", rec.ID, rec.Owner, rec.Attempts+1)
+		}
+		rec.Status = models.JobRunning
+		rec.Owner = c.cfg.Owner
+		rec.Attempts++
+		return &Job{Job: rec}, nil
+	}
+	return nil, nil
+}
+
+func (c *claimer) close() {
+	close(c.closed)
+}
@@ -0,0 +1,121 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"indico-be/internal/models"
+	"indico-be/internal/service"
+)
+
+const (
+	TypeSettlement        = "settlement"
+	TypeReconciliation    = "reconciliation"
+	TypeSettlementExport  = "settlement_export"
+	TypeTransactionImport = "transaction_import"
+)
+
+// Period is an inclusive range of days, both formatted 2006-01-02.
+type Period struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (p Period) validate() error {
+	from, err := models.ParseDate(p.From)
+	if err != nil {
+		return errors.New("from must be a date formatted YYYY-MM-DD")
+	}
+	to, err := models.ParseDate(p.To)
+	if err != nil {
+		return errors.New("to must be a date formatted YYYY-MM-DD")
+	}
+	if to.Before(from) {
+		return errors.New("to is before from")
+	}
+	return nil
+}
+
+// SettlementPayload runs a settlement over a period.
+type SettlementPayload struct {
+	Period
+	service.RunOptions
+}
+
+// ReconciliationPayload re-checks a period against its current settlements.
+type ReconciliationPayload struct {
+	Period
+}
+
+// SettlementExportPayload exports the current settlements of a period,
+// optionally for a single merchant, without recomputing them.
+type SettlementExportPayload struct {
+	Period
+	MerchantID uint64 `json:"merchant_id,omitempty"`
+}
+
+// TransactionImportPayload imports an uploaded transaction file.
+type TransactionImportPayload struct {
+	service.ImportOptions
+}
+
+// SettlementJob is the request for a settlement job of [from, to].
+func SettlementJob(from, to string, opts service.RunOptions) (EnqueueRequest, error) {
+	payload, err := json.Marshal(SettlementPayload{Period: Period{From: from, To: to}, RunOptions: opts})
+	if err != nil {
+		return EnqueueRequest{}, err
+	}
+	return EnqueueRequest{Type: TypeSettlement, Payload: payload}, nil
+}
+
+func csvResult(status models.JobStatus, jobID string) Result {
+	return Result{Status: status, ResultPath: "/public/downloads/" + jobID + ".csv"}
+}
+
+// RegisterDefaults registers the job types shipped with the service.
+func RegisterDefaults(r *Registry, settle *service.SettlementService, recon *service.ReconciliationService, imports *service.ImportService) {
+	r.Register(TypeSettlement, Typed(TypeSettlement,
+		func(p *SettlementPayload) error {
+			if err := p.Period.validate(); err != nil {
+				return err
+			}
+			return p.RunOptions.Normalize()
+		},
+		func(ctx context.Context, j *Job, p SettlementPayload) (Result, error) {
+			status, err := settle.RunJob(ctx, j.ID, p.From, p.To, p.RunOptions)
+			if err != nil {
+				// A run resumes from its checkpoint, so anything but a bad
+				// request is worth another attempt.
+				var invalid *service.ValidationError
+				if errors.As(err, &invalid) {
+					return Result{}, err
+				}
+				return Result{}, Retryable(err)
+			}
+			return csvResult(status, j.ID), nil
+		}))
+
+	r.Register(TypeReconciliation, Typed(TypeReconciliation,
+		func(p *ReconciliationPayload) error { return p.Period.validate() },
+		func(ctx context.Context, j *Job, p ReconciliationPayload) (Result, error) {
+			status, err := recon.RunJob(ctx, j.ID, p.From, p.To)
+			return Result{Status: status}, err
+		}))
+
+	r.Register(TypeSettlementExport, Typed(TypeSettlementExport,
+		func(p *SettlementExportPayload) error { return p.Period.validate() },
+		func(ctx context.Context, j *Job, p SettlementExportPayload) (Result, error) {
+			if err := settle.ExportCurrent(ctx, j.ID, p.From, p.To, p.MerchantID); err != nil {
+				return Result{}, err
+			}
+			return csvResult(models.JobFinished, j.ID), nil
+		}))
+
+	r.Register(TypeTransactionImport, Typed(TypeTransactionImport,
+		func(p *TransactionImportPayload) error { return p.ImportOptions.Normalize() },
+		func(ctx context.Context, j *Job, p TransactionImportPayload) (Result, error) {
+			status, rejects, err := imports.RunJob(ctx, j.ID, p.ImportOptions)
+			return Result{Status: status, ResultPath: rejects}, err
+		}))
+}
@@ -2,12 +2,28 @@ package job
 
 import (
 	"context"
-	"time"
+	"encoding/json"
+
+	"indico-be/internal/models"
 )
 
+// Job is a claimed job as its handler sees it: the stored job, with
+// Attempts already counting this claim, plus the cancel func of this run.
 type Job struct {
-	ID        string
-	From, To  time.Time
-	CreatedAt time.Time
-	Cancel    context.CancelFunc
+	models.Job
+	Cancel context.CancelFunc
+}
+
+// EnqueueRequest is everything a caller can ask of a new job.
+type EnqueueRequest struct {
+	Type           string
+	Payload        json.RawMessage
+	CallbackURL    string
+	CallbackSecret string
+	Queue          string
+	Tenant         string
+	// SkipCapacity enqueues even into a full queue, for jobs that must not
+	// be dropped, like scheduled settlements; their cron bounds how many
+	// arrive.
+	SkipCapacity bool
 }
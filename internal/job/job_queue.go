@@ -1,37 +1,50 @@
-// internal/job/job_queue.go (versi perbaikan)
 package job
 
 import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"indico-be/internal/models"
 	"indico-be/internal/repository"
+	"log"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// JobQueue is the façade used by HTTP handlers.
+// JobQueue is the façade used by HTTP handlers. Jobs live in job_records,
+// so a job enqueued on one instance may run on any other.
 type JobQueue struct {
-	queue      chan *Job
+	claims     *claimer
+	claimCfg   ClaimConfig
+	base       context.Context
+	stop       context.CancelCauseFunc
+	queues     []QueueConfig
 	workers    []*Worker
+	retiring   []*Worker
+	lastID     int
 	workerPool *WorkerPool
 	mu         sync.Mutex
 	jobRepo    repository.JobRepository
 }
 
-// NewJobQueue creates a channel + workers.
-func NewJobQueue(pool *WorkerPool) *JobQueue {
+// NewJobQueue creates the named queues + workers. weights gives tenants a
+// larger share of their queue; tenants not listed weigh 1.
+func NewJobQueue(pool *WorkerPool, repo repository.JobRepository, queues []QueueConfig, weights map[string]int, claim ClaimConfig) *JobQueue {
+	base, stop := context.WithCancelCause(context.Background())
 	q := &JobQueue{
-		queue:      make(chan *Job, 100),
+		claims:     newClaimer(claim, repo, pool.Jobs, weights),
+		claimCfg:   claim,
+		base:       base,
+		stop:       stop,
+		queues:     queues,
 		workerPool: pool,
+		jobRepo:    repo,
 	}
 	// attach workers
-	for i := 0; i < pool.Count; i++ {
-		w := NewWorker(i+1, pool.Service, q.queue)
-		w.Start()
-		q.workers = append(q.workers, w)
+	if err := q.Scale(pool.Count); err != nil {
+		log.Printf("[workers] %v, starting none", err)
 	}
 	return q
 }
@@ -41,47 +54,160 @@ func generateJobID() string {
 	return uuid.NewString()
 }
 
-func (jq *JobQueue) SetRepository(repo repository.JobRepository) {
-	jq.jobRepo = repo
+func (q *JobQueue) queue(name string) (QueueConfig, error) {
+	for _, cfg := range q.queues {
+		if cfg.Name == name {
+			return cfg, nil
+		}
+	}
+	return QueueConfig{}, fmt.Errorf("%w: %q", ErrUnknownQueue, name)
+}
+
+// Enqueue validates the payload with the handler of req.Type and stores the
+// job as QUEUED without blocking. A full queue returns a *QueueFullError
+// (matching ErrQueueFull) instead of waiting for room.
+func (q *JobQueue) Enqueue(req EnqueueRequest) (string, error) {
+	rec, err := q.NewRecord(req)
+	if err != nil {
+		return "", err
+	}
+	if err := q.workerPool.Jobs.Submit(context.Background(), rec); err != nil {
+		return "", fmt.Errorf("failed storing job: %w", err)
+	}
+	q.claims.notify()
+	return rec.ID, nil
 }
 
-// Enqueue creates a Job record and pushes to channel.
-func (q *JobQueue) Enqueue(from, to string) (string, error) {
-	// --------- 1️⃣ Parse tanggal ----------
-	fromT, err := time.Parse("2006-01-02", from)
+// NewRecord does what Enqueue does short of storing the job: it returns the
+// QUEUED record for a caller that inserts it in a transaction of its own,
+// then calls Submitted.
+func (q *JobQueue) NewRecord(req EnqueueRequest) (*models.Job, error) {
+	ctx := context.Background()
+
+	// --------- 1️⃣ Validasi payload ----------
+	h, err := q.workerPool.Registry.Get(req.Type)
 	if err != nil {
-		return "", fmt.Errorf("invalid from date: %w", err)
+		return nil, err
 	}
-	toT, err := time.Parse("2006-01-02", to)
+	payload, err := h.Prepare(req.Payload)
 	if err != nil {
-		return "", fmt.Errorf("invalid to date: %w", err)
+		return nil, err
 	}
 
-	// --------- 2️⃣ Buat objek Job ----------
-	j := &Job{
-		ID:        generateJobID(),
-		From:      fromT,
-		To:        toT,
-		CreatedAt: time.Now(),
+	if req.Queue == "" {
+		req.Queue = QueueDefault
+	}
+	if req.Tenant == "" {
+		req.Tenant = DefaultTenant
+	}
+	cfg, err := q.queue(req.Queue)
+	if err != nil {
+		return nil, err
 	}
 
-	// 🔥 HAPUS: TIDAK PERLU SAVE ke DB di sini!
-	// JANGAN panggil q.jobRepo.Create
+	// --------- 2️⃣ Cek kapasitas antrian ----------
+	// The count is not locked, so a burst can overshoot Capacity slightly;
+	// it bounds the backlog, not a hard limit.
+	if !req.SkipCapacity {
+		waiting, err := q.jobRepo.CountQueued(ctx, cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		if waiting >= int64(cfg.Capacity) {
+			return nil, &QueueFullError{Queue: cfg.Name, RetryAfter: cfg.RetryAfter}
+		}
+	}
 
-	// --------- 3️⃣ Kirim ke channel ---------- (HANYA ini yang diperlukan!)
-	q.queue <- j
-	return j.ID, nil
+	// --------- 3️⃣ Siapkan job ----------
+	now := time.Now()
+	return &models.Job{
+		ID:        generateJobID(),
+		Type:      req.Type,
+		Payload:   payload,
+		Status:    models.JobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+
+		CallbackURL:    req.CallbackURL,
+		CallbackSecret: req.CallbackSecret,
+
+		Queue:    cfg.Name,
+		Tenant:   req.Tenant,
+		Priority: cfg.Priority,
+	}, nil
+}
+
+// Submitted announces a record from NewRecord once its caller has stored
+// it, and wakes an idle worker.
+func (q *JobQueue) Submitted(rec *models.Job) {
+	q.workerPool.Jobs.Submitted(rec)
+	q.claims.notify()
 }
 
-// Cancel a running job.
+// Cancel a queued or running job.
 func (q *JobQueue) Cancel(jobID string) error {
-	// Mark cancelled in DB – workers will notice via the job record.
-	return q.jobRepo.MarkCancelled(context.Background(), jobID)
+	// Mark cancelled in DB – the owning worker loses its lease on the next
+	// heartbeat and stops.
+	return q.workerPool.Jobs.CancelJob(context.Background(), jobID)
 }
 
-// Close shuts down the channel (used on graceful shutdown).
-func (q *JobQueue) Close() {
-	close(q.queue)
+// Shutdown stops claiming jobs and tells running ones to stop at their next
+// checkpoint; they are stored as INTERRUPTED and resume on whichever
+// instance claims them next. Jobs still running when ctx ends stay RUNNING:
+// their handlers may still be writing, so they are only reclaimed once the
+// lease this process stops renewing has expired.
+func (q *JobQueue) Shutdown(ctx context.Context) error {
+	q.claims.close()
+	q.stop(ErrShuttingDown)
+
+	q.mu.Lock()
+	all := append(append([]*Worker(nil), q.workers...), q.retiring...)
+	q.mu.Unlock()
+
+	for _, w := range all {
+		select {
+		case <-w.Done():
+		case <-ctx.Done():
+			busy := 0
+			for _, w := range all {
+				if w.Busy() {
+					busy++
+				}
+			}
+			return fmt.Errorf("%d jobs still running at the shutdown deadline, left RUNNING until their lease expires: %w", busy, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Types lists the job types that can be enqueued.
+func (q *JobQueue) Types() []string {
+	return q.workerPool.Registry.Types()
+}
+
+// Stats reports the backlog of every queue across all instances.
+func (q *JobQueue) Stats() ([]QueueStats, error) {
+	counts, err := q.jobRepo.QueuedByTenant(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]QueueStats, 0, len(q.queues))
+	for _, cfg := range q.queues {
+		st := QueueStats{
+			Name:     cfg.Name,
+			Priority: cfg.Priority,
+			Capacity: cfg.Capacity,
+			Tenants:  make(map[string]int),
+		}
+		for _, c := range counts {
+			if c.Queue == cfg.Name {
+				st.Tenants[c.Tenant] = c.Count
+				st.Waiting += c.Count
+			}
+		}
+		out = append(out, st)
+	}
+	return out, nil
 }
 
 // Helper to return JSON status for API.
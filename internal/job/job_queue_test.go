@@ -0,0 +1,59 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository/repotest"
+	"indico-be/internal/service"
+)
+
+// stuckHandler ignores its context until released.
+type stuckHandler struct {
+	started, release chan struct{}
+}
+
+func (h stuckHandler) Prepare(p json.RawMessage) (json.RawMessage, error) { return p, nil }
+
+func (h stuckHandler) Run(ctx context.Context, _ *Job) (Result, error) {
+	close(h.started)
+	<-h.release
+	return Result{}, ctx.Err()
+}
+
+func TestShutdownDeadlineLeavesJobRunning(t *testing.T) {
+	h := stuckHandler{started: make(chan struct{}), release: make(chan struct{})}
+	reg := NewRegistry()
+	reg.Register("stuck", h)
+	jobRepo := repotest.NewJobs(models.Job{ID: "job-1", Type: "stuck", Status: models.JobQueued, Queue: QueueDefault})
+	jobs := service.NewJobService(jobRepo, nil)
+	cfg := ClaimConfig{Owner: "test", Lease: time.Minute, Poll: time.Millisecond, MaxAttempts: 3}
+	q := NewJobQueue(NewWorkerPool(1, reg, jobs), jobRepo, DefaultQueues, nil, cfg)
+	<-h.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want the deadline", err)
+	}
+	rec, _ := jobRepo.GetByID(context.Background(), "job-1")
+	if rec.Status != models.JobRunning || rec.Owner != "test" {
+		t.Fatalf("after the deadline: %s held by %q; want RUNNING held by this instance", rec.Status, rec.Owner)
+	}
+
+	// Once the handler does return, the job is handed back as usual.
+	close(h.release)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		rec, _ = jobRepo.GetByID(context.Background(), "job-1")
+		if rec.Status == models.JobInterrupted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s after the handler returned, want INTERRUPTED", rec.Status)
+		}
+	}
+}
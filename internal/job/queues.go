@@ -0,0 +1,134 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"indico-be/internal/models"
+)
+
+const (
+	QueueHigh     = "high"
+	QueueDefault  = "default"
+	QueueBackfill = "backfill"
+
+	// DefaultTenant is used when a submitter does not identify itself.
+	DefaultTenant = "anonymous"
+)
+
+var (
+	ErrQueueFull    = errors.New("queue is full")
+	ErrUnknownQueue = errors.New("unknown queue")
+)
+
+// QueueConfig describes one named queue. Higher Priority is always served
+// first; Capacity bounds how many jobs may wait in it across all instances.
+type QueueConfig struct {
+	Name       string
+	Priority   int
+	Capacity   int
+	RetryAfter time.Duration
+}
+
+// DefaultQueues keeps interactive runs ahead of large backfills.
+var DefaultQueues = []QueueConfig{
+	{Name: QueueHigh, Priority: 20, Capacity: 100, RetryAfter: 10 * time.Second},
+	{Name: QueueDefault, Priority: 10, Capacity: 100, RetryAfter: 30 * time.Second},
+	{Name: QueueBackfill, Priority: 0, Capacity: 20, RetryAfter: 5 * time.Minute},
+}
+
+// QueueFullError tells the caller when it is worth trying again.
+type QueueFullError struct {
+	Queue      string
+	RetryAfter time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("queue %q is full, retry after %s", e.Queue, e.RetryAfter)
+}
+
+func (e *QueueFullError) Is(target error) bool { return target == ErrQueueFull }
+
+// fairPicker chooses which claimable job an instance should try next:
+// strictly by queue priority, and within a queue by smooth weighted
+// round-robin across tenants, so one submitter's backlog cannot starve the
+// others. The round-robin state is per instance, which is fair enough as
+// every instance sees the same heads.
+type fairPicker struct {
+	mu      sync.Mutex
+	weights map[string]int
+	// current is the smooth round-robin credit per queue and tenant.
+	current map[string]map[string]int
+}
+
+func newFairPicker(weights map[string]int) *fairPicker {
+	return &fairPicker{weights: weights, current: make(map[string]map[string]int)}
+}
+
+// pick returns the index of the head to claim next. heads holds the oldest
+// claimable job of every queue/tenant, highest priority first.
+func (p *fairPicker) pick(heads []models.Job) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	top := heads[0].Priority
+	queue := heads[0].Queue
+	credit, ok := p.current[queue]
+	if !ok {
+		credit = make(map[string]int)
+		p.current[queue] = credit
+	}
+
+	best, totalWgt := -1, 0
+	seen := make(map[string]bool)
+	for i, h := range heads {
+		if h.Priority != top || h.Queue != queue || seen[h.Tenant] {
+			continue
+		}
+		seen[h.Tenant] = true
+		w := p.weight(h.Tenant)
+		credit[h.Tenant] += w
+		totalWgt += w
+		// Ties go to the lexically smaller tenant for a deterministic order.
+		if best < 0 || credit[h.Tenant] > credit[heads[best].Tenant] ||
+			(credit[h.Tenant] == credit[heads[best].Tenant] && h.Tenant < heads[best].Tenant) {
+			best = i
+		}
+	}
+	credit[heads[best].Tenant] -= totalWgt
+
+	// Tenants without work start from zero when they come back.
+	for tenant := range credit {
+		if !hasTenant(heads, queue, tenant) {
+			delete(credit, tenant)
+		}
+	}
+	return best
+}
+
+func hasTenant(heads []models.Job, queue, tenant string) bool {
+	for _, h := range heads {
+		if h.Queue == queue && h.Tenant == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *fairPicker) weight(tenant string) int {
+	if w, ok := p.weights[tenant]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// QueueStats is the backlog of one queue per tenant.
+type QueueStats struct {
+	Name     string         `json:"name"`
+	Priority int            `json:"priority"`
+	Capacity int            `json:"capacity"`
+	Waiting  int            `json:"waiting"`
+	Tenants  map[string]int `json:"tenants"`
+}
@@ -0,0 +1,149 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"indico-be/internal/models"
+)
+
+// ErrUnknownType is returned for a job type nobody registered.
+var ErrUnknownType = errors.New("unknown job type")
+
+// Result is what a handler reports when its job ends without error.
+type Result struct {
+	// Status is the terminal status; empty means FINISHED.
+	Status models.JobStatus
+	// ResultPath points at the file the job produced, if any.
+	ResultPath string
+}
+
+// Handler runs one type of background job.
+type Handler interface {
+	// Prepare validates a submitted payload and returns it normalized, as it
+	// will be stored on the job record and handed to Run.
+	Prepare(payload json.RawMessage) (json.RawMessage, error)
+	Run(ctx context.Context, j *Job) (Result, error)
+}
+
+// PayloadError marks a payload the submitter got wrong.
+type PayloadError struct {
+	Type string
+	Err  error
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("invalid %s payload: %v", e.Type, e.Err)
+}
+
+func (e *PayloadError) Unwrap() error { return e.Err }
+
+// RetryableError marks a failure worth running the job again for, e.g. a
+// lost database connection. The next run resumes from whatever the failed
+// one saved.
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+// Retryable marks err as a RetryableError; nil stays nil.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// typed adapts a function taking a decoded payload P to Handler.
+type typed[P any] struct {
+	name     string
+	validate func(*P) error
+	run      func(ctx context.Context, j *Job, p P) (Result, error)
+}
+
+// Typed builds a Handler whose payload is the JSON encoding of P. validate
+// may fill defaults in place; it is optional.
+func Typed[P any](name string, validate func(*P) error, run func(ctx context.Context, j *Job, p P) (Result, error)) Handler {
+	return &typed[P]{name: name, validate: validate, run: run}
+}
+
+func (h *typed[P]) decode(payload json.RawMessage) (P, error) {
+	var p P
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return p, &PayloadError{Type: h.name, Err: err}
+	}
+	if h.validate != nil {
+		if err := h.validate(&p); err != nil {
+			return p, &PayloadError{Type: h.name, Err: err}
+		}
+	}
+	return p, nil
+}
+
+func (h *typed[P]) Prepare(payload json.RawMessage) (json.RawMessage, error) {
+	p, err := h.decode(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(p)
+}
+
+func (h *typed[P]) Run(ctx context.Context, j *Job) (Result, error) {
+	p, err := h.decode(j.Payload)
+	if err != nil {
+		return Result{}, err
+	}
+	return h.run(ctx, j, p)
+}
+
+// Registry maps job types to their handlers.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]Handler)}
+}
+
+// Register adds a handler; registering a type twice is a programming error.
+func (r *Registry) Register(jobType string, h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.handlers[jobType]; dup {
+		panic(fmt.Sprintf("job type %q registered twice", jobType))
+	}
+	r.handlers[jobType] = h
+}
+
+func (r *Registry) Get(jobType string) (Handler, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.handlers[jobType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, jobType)
+	}
+	return h, nil
+}
+
+// Types lists the registered job types in order.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,120 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// MaxWorkers bounds Scale so a typo cannot start thousands of goroutines
+// hammering the database.
+const MaxWorkers = 256
+
+// PoolStatus describes this instance's workers.
+type PoolStatus struct {
+	Instance string         `json:"instance"`
+	Paused   bool           `json:"paused"`
+	Count    int            `json:"count"`
+	Workers  []WorkerStatus `json:"workers"`
+}
+
+// Scale grows or shrinks this instance's workers to n. Retired workers
+// finish their current job first; idle ones are retired before busy ones.
+func (q *JobQueue) Scale(n int) error {
+	if n < 0 || n > MaxWorkers {
+		return fmt.Errorf("worker count must be between 0 and %d", MaxWorkers)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.workers) < n {
+		q.lastID++
+		w := NewWorker(q.lastID, q.workerPool.Registry, q.workerPool.Jobs, q.claimCfg, q.claims.next)
+		w.Start(q.base)
+		q.workers = append(q.workers, w)
+	}
+
+	for len(q.workers) > n {
+		i := len(q.workers) - 1
+		for j := i; j >= 0; j-- {
+			if !q.workers[j].Busy() {
+				i = j
+				break
+			}
+		}
+		w := q.workers[i]
+		q.workers = append(q.workers[:i], q.workers[i+1:]...)
+		w.Stop()
+		q.retiring = append(q.retiring, w)
+	}
+
+	log.Printf("[workers] scaled to %d", n)
+	return nil
+}
+
+// Pause stops this instance from claiming jobs, e.g. during database
+// maintenance; running jobs carry on.
+func (q *JobQueue) Pause() {
+	q.claims.pause()
+	log.Printf("[workers] paused")
+}
+
+func (q *JobQueue) Resume() {
+	q.claims.resume()
+	log.Printf("[workers] resumed")
+}
+
+// Running returns an error when this instance cannot run jobs: it is
+// shutting down, has no workers, or a worker has exited.
+func (q *JobQueue) Running() error {
+	if q.base.Err() != nil {
+		return errors.New("shutting down")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.workers) == 0 {
+		return errors.New("no workers")
+	}
+	for _, w := range q.workers {
+		select {
+		case <-w.Done():
+			return fmt.Errorf("worker %d has exited", w.id)
+		default:
+		}
+	}
+	return nil
+}
+
+// Workers reports every worker of this instance, including retiring ones
+// still finishing a job.
+func (q *JobQueue) Workers() PoolStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Forget retired workers that have stopped.
+	live := q.retiring[:0]
+	for _, w := range q.retiring {
+		select {
+		case <-w.Done():
+		default:
+			live = append(live, w)
+		}
+	}
+	q.retiring = live
+
+	out := PoolStatus{
+		Instance: q.claimCfg.Owner,
+		Paused:   q.claims.isPaused(),
+		Count:    len(q.workers),
+	}
+	for _, w := range q.workers {
+		out.Workers = append(out.Workers, w.Status())
+	}
+	for _, w := range q.retiring {
+		out.Workers = append(out.Workers, w.Status())
+	}
+	return out
+}
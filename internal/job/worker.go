@@ -2,58 +2,252 @@ package job
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
-	"indico-be/internal/repository"
+	"indico-be/internal/models"
 	"indico-be/internal/service"
 )
 
+// ErrShuttingDown is the cancel cause of jobs stopped by a shutdown.
+var ErrShuttingDown = errors.New("shutting down")
+
 type Worker struct {
-	id      int
-	svc     *service.SettlementService
-	jobChan <-chan *Job
+	id       int
+	registry *Registry
+	jobs     *service.JobService
+	claim    ClaimConfig
+	next     func(stop <-chan struct{}) (*Job, bool)
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu         sync.Mutex
+	current    *Job
+	jobStarted time.Time
+	idleSince  time.Time
+	stopping   bool
 }
 
-func NewWorker(id int, svc *service.SettlementService, jobChan <-chan *Job) *Worker {
-	return &Worker{id: id, svc: svc, jobChan: jobChan}
+// WorkerStatus is what a worker is doing right now.
+type WorkerStatus struct {
+	ID    int    `json:"id"`
+	State string `json:"state"` // idle, busy or stopping
+	// The current job, if any.
+	JobID        string     `json:"job_id,omitempty"`
+	JobType      string     `json:"job_type,omitempty"`
+	JobStartedAt *time.Time `json:"job_started_at,omitempty"`
+	// IdleSeconds is how long the worker has been waiting for a job.
+	IdleSeconds int64 `json:"idle_seconds"`
 }
 
-func (w *Worker) Start() {
+// NewWorker creates a worker that takes jobs from next until it reports false
+// and runs each with the handler registered for its type.
+func NewWorker(id int, registry *Registry, jobs *service.JobService, claim ClaimConfig, next func(stop <-chan struct{}) (*Job, bool)) *Worker {
+	return &Worker{
+		id:        id,
+		registry:  registry,
+		jobs:      jobs,
+		claim:     claim,
+		next:      next,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		idleSince: time.Now(),
+	}
+}
+
+// Start runs jobs until next reports false or Stop is called. Jobs run
+// under base, so cancelling it with ErrShuttingDown stops them at their
+// next checkpoint.
+func (w *Worker) Start(base context.Context) {
 	go func() {
-		for job := range w.jobChan {
-			ctx, cancel := context.WithCancel(context.Background())
-			job.Cancel = cancel
-
-			log.Printf("[worker %d] started job %s", w.id, job.ID)
-
-			rec := &repository.JobRecord{
-				ID:         job.ID,
-				Status:     "RUNNING",
-				Progress:   0,
-				Processed:  0,
-				Total:      0,
-				ResultPath: "",
-				CreatedAt:  job.CreatedAt,
-				UpdatedAt:  time.Now(),
-				Cancelled:  false,
-				CancelAt:   nil,
+		defer close(w.done)
+		for {
+			job, ok := w.next(w.stop)
+			if !ok {
+				return
 			}
+			w.setCurrent(job)
+			w.process(base, job)
+			w.setCurrent(nil)
+		}
+	}()
+}
 
-			if err := w.svc.JobRepo.Create(context.Background(), rec); err != nil {
-				log.Printf("[worker %d] gagal membuat job di DB: %v", w.id, err)
-				continue 
-			}
+// Stop retires the worker once its current job, if any, is done.
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stopping {
+		w.stopping = true
+		close(w.stop)
+	}
+}
+
+func (w *Worker) setCurrent(job *Job) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current = job
+	if job != nil {
+		w.jobStarted = time.Now()
+	} else {
+		w.idleSince = time.Now()
+	}
+}
+
+// Busy reports whether the worker is running a job.
+func (w *Worker) Busy() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current != nil
+}
+
+func (w *Worker) Status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	st := WorkerStatus{ID: w.id, State: "idle"}
+	if w.current != nil {
+		started := w.jobStarted
+		st.State = "busy"
+		st.JobID = w.current.ID
+		st.JobType = w.current.Type
+		st.JobStartedAt = &started
+	} else {
+		st.IdleSeconds = int64(time.Since(w.idleSince).Seconds())
+	}
+	if w.stopping {
+		st.State = "stopping"
+	}
+	return st
+}
+
+// Done is closed once the worker has stopped.
+func (w *Worker) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *Worker) process(base context.Context, job *Job) {
+	log.Printf("[worker %d] started %s job %s (queue %s, tenant %s, attempt %d)", w.id, job.Type, job.ID, job.Queue, job.Tenant, job.Attempts)
+	w.execute(base, job)
+}
 
-			if err := w.svc.RunJob(ctx, job.ID, job.From.Format("2006-01-02"), job.To.Format("2006-01-02")); err != nil {
-				log.Printf("[worker %d] job %s gagal: %v", w.id, job.ID, err)
+// execute runs a job this worker holds under base and records how it
+// ended. It returns the stored result, or the error the job failed or was
+// interrupted with.
+func (w *Worker) execute(base context.Context, job *Job) (Result, error) {
+	if w.claim.MaxAttempts > 0 && job.Attempts > w.claim.MaxAttempts {
+		err := fmt.Errorf("abandoned by its worker %d times", job.Attempts-1)
+		w.finish(job, models.JobFailed, "", err)
+		return Result{}, err
+	}
 
-				_ = w.svc.JobRepo.UpdateStatus(context.Background(), job.ID, "FAILED")
-			} else {
-				log.Printf("[worker %d] job %s berhasil", w.id, job.ID)
+	ctx, cancel := context.WithCancel(base)
+	job.Cancel = cancel
+	defer cancel()
 
-				_ = w.svc.JobRepo.UpdateStatus(context.Background(), job.ID, "FINISHED")
+	stop := w.heartbeat(job)
+	res, err := w.run(ctx, job)
+	stop()
+
+	if err != nil && errors.Is(context.Cause(ctx), ErrShuttingDown) {
+		w.interrupt(job, err)
+		return Result{}, err
+	}
+	// A job run by RunNow has nobody to claim it again; its caller gets the
+	// error instead.
+	var retryable *RetryableError
+	if err != nil && errors.As(err, &retryable) && w.next != nil && job.Attempts < w.claim.MaxAttempts {
+		w.retry(job, err)
+		return Result{}, err
+	}
+	if err != nil {
+		log.Printf("[worker %d] job %s gagal: %v", w.id, job.ID, err)
+		w.finish(job, models.JobFailed, "", err)
+		return Result{}, err
+	}
+	if res.Status == "" {
+		res.Status = models.JobFinished
+	}
+	if !w.finish(job, res.Status, res.ResultPath, nil) {
+		return Result{}, fmt.Errorf("job %s was cancelled or reclaimed", job.ID)
+	}
+	log.Printf("[worker %d] job %s berhasil (%s)", w.id, job.ID, res.Status)
+	return res, nil
+}
+
+// heartbeat renews the job's lease until stop is called, also while a
+// shutting-down job winds down. When the lease is lost – the job was
+// cancelled or another instance reclaimed it – the job's context is
+// cancelled.
+func (w *Worker) heartbeat(job *Job) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(w.claim.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			held, err := w.jobs.Heartbeat(context.Background(), job.ID, w.claim.Owner, time.Now().Add(w.claim.Lease))
+			if err != nil {
+				// Keep going: the lease is long enough to ride out a blip.
+				log.Printf("[worker %d] heartbeat job %s gagal: %v", w.id, job.ID, err)
+				continue
+			}
+			if !held {
+				log.Printf("[worker %d] job %s no longer held, stopping", w.id, job.ID)
+				job.Cancel()
+				return
 			}
 		}
 	}()
+	return func() { close(done) }
+}
+
+func (w *Worker) finish(job *Job, status models.JobStatus, resultPath string, cause error) bool {
+	won, err := w.jobs.Finish(context.Background(), job.ID, w.claim.Owner, status, resultPath, cause)
+	if err != nil {
+		log.Printf("[worker %d] gagal menyimpan status job %s: %v", w.id, job.ID, err)
+		return false
+	}
+	if !won {
+		log.Printf("[worker %d] job %s was cancelled or reclaimed, dropping %s", w.id, job.ID, status)
+	}
+	return won
+}
+
+func (w *Worker) interrupt(job *Job, cause error) {
+	won, err := w.jobs.Interrupt(context.Background(), job.ID, w.claim.Owner)
+	switch {
+	case err != nil:
+		log.Printf("[worker %d] gagal menandai job %s INTERRUPTED: %v", w.id, job.ID, err)
+	case won:
+		log.Printf("[worker %d] job %s interrupted (%v), will resume on next start", w.id, job.ID, cause)
+	}
+}
+
+// retry gives a job that failed with a RetryableError back to the queue
+// for another attempt after a delay growing with its attempts.
+func (w *Worker) retry(job *Job, cause error) {
+	delay := w.claim.RetryDelay * time.Duration(job.Attempts)
+	won, err := w.jobs.Retry(context.Background(), job.ID, w.claim.Owner, time.Now().Add(delay), cause)
+	switch {
+	case err != nil:
+		log.Printf("[worker %d] gagal menjadwalkan ulang job %s: %v", w.id, job.ID, err)
+	case won:
+		log.Printf("[worker %d] job %s gagal (%v), retry in %s (attempt %d of %d)", w.id, job.ID, cause, delay, job.Attempts, w.claim.MaxAttempts)
+	}
+}
+
+func (w *Worker) run(ctx context.Context, job *Job) (Result, error) {
+	h, err := w.registry.Get(job.Type)
+	if err != nil {
+		return Result{}, err
+	}
+	return h.Run(ctx, job)
 }
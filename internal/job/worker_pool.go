@@ -1,12 +1,66 @@
 package job
 
-import "indico-be/internal/service"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/service"
+)
 
 type WorkerPool struct {
-	Count   int
-	Service *service.SettlementService
+	Count    int
+	Registry *Registry
+	Jobs     *service.JobService
+}
+
+func NewWorkerPool(count int, registry *Registry, jobs *service.JobService) *WorkerPool {
+	return &WorkerPool{Count: count, Registry: registry, Jobs: jobs}
 }
 
-func NewWorkerPool(count int, svc *service.SettlementService) *WorkerPool {
-	return &WorkerPool{Count: count, Service: svc}
+// RunNow runs req in the calling goroutine instead of queueing it, e.g. for
+// a run started from the shell. The job is stored already claimed by
+// claim.Owner, so it is listed, heartbeated and finished like any other but
+// no worker picks it up. Cancelling ctx with cause ErrShuttingDown leaves it
+// INTERRUPTED for a worker to resume.
+func (p *WorkerPool) RunNow(ctx context.Context, claim ClaimConfig, req EnqueueRequest) (*Job, Result, error) {
+	h, err := p.Registry.Get(req.Type)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	payload, err := h.Prepare(req.Payload)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	if req.Queue == "" {
+		req.Queue = QueueDefault
+	}
+	if req.Tenant == "" {
+		req.Tenant = DefaultTenant
+	}
+
+	now := time.Now()
+	j := &Job{Job: models.Job{
+		ID:        generateJobID(),
+		Type:      req.Type,
+		Payload:   payload,
+		Status:    models.JobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+
+		CallbackURL:    req.CallbackURL,
+		CallbackSecret: req.CallbackSecret,
+
+		Queue:  req.Queue,
+		Tenant: req.Tenant,
+	}}
+	if err := p.Jobs.SubmitClaimed(ctx, &j.Job, claim.Owner, now.Add(claim.Lease)); err != nil {
+		return nil, Result{}, fmt.Errorf("failed storing job: %w", err)
+	}
+	j.Status, j.Owner, j.Attempts = models.JobRunning, claim.Owner, 1
+
+	w := NewWorker(0, p.Registry, p.Jobs, claim, nil)
+	res, err := w.execute(ctx, j)
+	return j, res, err
 }
@@ -0,0 +1,197 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+	"indico-be/internal/repository/repotest"
+	"indico-be/internal/service"
+)
+
+const retryDelay = 20 * time.Millisecond
+
+type settlementRig struct {
+	txs      *repotest.Transactions
+	settles  *repotest.Settlements
+	jobs     *repotest.Jobs
+	claimer  *claimer
+	worker   *Worker
+	attempts int
+}
+
+// newSettlementRig queues settlement job job-1 for 1–3 January and wires the
+// real claimer, worker and settlement service to in-memory repositories.
+func newSettlementRig(t *testing.T, txRepo *repotest.Transactions, parallelism, maxAttempts int) *settlementRig {
+	req, err := SettlementJob("2025-01-01", "2025-01-03", service.RunOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobRepo := repotest.NewJobs(models.Job{ID: "job-1", Type: req.Type, Payload: req.Payload, Status: models.JobQueued})
+	setRepo := repotest.NewSettlements()
+	jobs := service.NewJobService(jobRepo, nil)
+	recon := service.NewReconciliationService(txRepo, setRepo, repotest.Reconciliations{})
+	settle := service.NewSettlementService(txRepo, setRepo, nil, recon, jobs)
+	settle.SetBatchSize(4)
+	settle.SetParallelism(parallelism)
+	settle.SetExportDir(t.TempDir())
+
+	reg := NewRegistry()
+	RegisterDefaults(reg, settle, recon, nil)
+	cfg := ClaimConfig{Owner: "test", Lease: time.Minute, Poll: time.Millisecond, MaxAttempts: maxAttempts, RetryDelay: retryDelay}
+	c := newClaimer(cfg, jobRepo, jobs, nil)
+	return &settlementRig{
+		txs:     txRepo,
+		settles: setRepo,
+		jobs:    jobRepo,
+		claimer: c,
+		worker:  NewWorker(1, reg, jobs, cfg, c.next),
+	}
+}
+
+// attempt claims job-1 as an idle worker would and runs it.
+func (r *settlementRig) attempt(t *testing.T) error {
+	t.Helper()
+	j, err := r.claimer.claim(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("job-1 not claimable")
+	}
+	r.attempts++
+	if j.Attempts != r.attempts {
+		t.Fatalf("claimed attempt %d, want %d", j.Attempts, r.attempts)
+	}
+	_, err = r.worker.execute(context.Background(), j)
+	return err
+}
+
+// awaitRetry checks that a retried job is held back for its delay, then
+// waits it out.
+func (r *settlementRig) awaitRetry(t *testing.T) {
+	t.Helper()
+	rec := r.record(t)
+	if rec.Status != models.JobInterrupted || rec.Error == "" {
+		t.Fatalf("after a failed attempt: status %s, error %q; want INTERRUPTED with the error", rec.Status, rec.Error)
+	}
+	if j, _ := r.claimer.claim(context.Background()); j != nil {
+		t.Fatal("job reclaimed before its retry delay")
+	}
+	time.Sleep(retryDelay*time.Duration(r.attempts) + 10*time.Millisecond)
+}
+
+func (r *settlementRig) record(t *testing.T) *models.Job {
+	t.Helper()
+	rec, err := r.jobs.GetByID(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestSettlementJobResumesAfterFailedBatch(t *testing.T) {
+	for _, parallelism := range []int{1, 3} {
+		t.Run(map[int]string{1: "sequential", 3: "sharded"}[parallelism], func(t *testing.T) {
+			txs := repotest.SettlementFixture()
+			rig := newSettlementRig(t, &repotest.Transactions{Txs: txs, FailAt: 3}, parallelism, 3)
+
+			if err := rig.attempt(t); err == nil {
+				t.Fatal("attempt with a failing batch succeeded")
+			}
+			if n := len(rig.settles.Written()); n != 0 {
+				t.Fatalf("failed attempt wrote %d settlements", n)
+			}
+			cp, ok := rig.settles.Checkpoint("job-1")
+			if !ok {
+				t.Fatal("no checkpoint kept for the retry")
+			}
+			if parallelism == 1 && cp.Processed != 8 {
+				t.Errorf("checkpoint processed = %d, want the 8 rows of the two batches before the failure", cp.Processed)
+			}
+			rig.awaitRetry(t)
+
+			rig.txs.FailAt = 0
+			rig.txs.Reset()
+			if err := rig.attempt(t); err != nil {
+				t.Fatalf("retry: %v", err)
+			}
+			if rec := rig.record(t); rec.Status != models.JobFinished {
+				t.Errorf("status = %s, want FINISHED", rec.Status)
+			}
+			read, afters := rig.txs.Read()
+			if want := len(txs) - int(cp.Processed); read != want {
+				t.Errorf("retry read %d transactions, want the %d left after the checkpoint", read, want)
+			}
+			if parallelism == 1 {
+				want := repository.Cursor{PaidAt: txs[7].PaidAt, ID: txs[7].ID}
+				if afters[0] != want {
+					t.Errorf("retry started after %v, want %v", afters[0], want)
+				}
+			}
+
+			// Every merchant/day is written once, holding each transaction once.
+			type key struct {
+				merchant uint64
+				date     string
+			}
+			want := make(map[key]models.Settlement)
+			for _, tx := range txs {
+				k := key{tx.MerchantID, tx.PaidAt.Format("2006-01-02")}
+				s := want[k]
+				s.GrossCents += tx.AmountCents
+				s.FeeCents += tx.FeeCents
+				s.NetCents += tx.AmountCents - tx.FeeCents
+				s.TxnCount++
+				want[k] = s
+			}
+			got := make(map[key]models.Settlement)
+			for _, s := range rig.settles.Written() {
+				k := key{s.MerchantID, s.Date.Format("2006-01-02")}
+				if _, dup := got[k]; dup {
+					t.Errorf("settlement %v written twice", k)
+				}
+				got[k] = s
+			}
+			if len(got) != len(want) {
+				t.Errorf("wrote %d settlements, want %d", len(got), len(want))
+			}
+			for k, w := range want {
+				g := got[k]
+				if g.GrossCents != w.GrossCents || g.FeeCents != w.FeeCents || g.NetCents != w.NetCents || g.TxnCount != w.TxnCount {
+					t.Errorf("%v: gross/fee/net/count = %d/%d/%d/%d, want %d/%d/%d/%d", k,
+						g.GrossCents, g.FeeCents, g.NetCents, g.TxnCount, w.GrossCents, w.FeeCents, w.NetCents, w.TxnCount)
+				}
+			}
+			if _, ok := rig.settles.Checkpoint("job-1"); ok {
+				t.Error("checkpoint kept after the job finished")
+			}
+		})
+	}
+}
+
+func TestSettlementJobFailsAfterMaxAttempts(t *testing.T) {
+	// Every attempt gets one batch in before failing.
+	rig := newSettlementRig(t, &repotest.Transactions{Txs: repotest.SettlementFixture(), FailAt: 2}, 1, 2)
+
+	if err := rig.attempt(t); err == nil {
+		t.Fatal("first attempt succeeded")
+	}
+	rig.awaitRetry(t)
+	rig.txs.Reset()
+	if err := rig.attempt(t); err == nil {
+		t.Fatal("second attempt succeeded")
+	}
+
+	if rec := rig.record(t); rec.Status != models.JobFailed {
+		t.Errorf("status = %s, want FAILED once MaxAttempts are used", rec.Status)
+	}
+	if _, ok := rig.settles.Checkpoint("job-1"); ok {
+		t.Error("checkpoint kept for a failed job")
+	}
+	if j, _ := rig.claimer.claim(context.Background()); j != nil {
+		t.Error("failed job claimed again")
+	}
+}
@@ -0,0 +1,423 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockName serialises migrations across instances sharing one database.
+const lockName = "indico_schema_migrations"
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+var ErrDirty = errors.New("schema is dirty")
+
+// Migration is one schema version: Up applies it, Down reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (m Migration) String() string { return fmt.Sprintf("%02d_%s", m.Version, m.Name) }
+
+// Status is one migration as seen by `migrate status`.
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	Dirty     bool       `json:"dirty,omitempty"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type appliedRow struct {
+	name      string
+	dirty     bool
+	appliedAt time.Time
+}
+
+// Migrator applies migrations in version order and records each one in
+// schema_migrations. MySQL commits DDL implicitly, so a version is marked
+// dirty while it runs; a failure leaves it dirty until fixed by hand and
+// cleared with Force.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	ms, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: ms}, nil
+}
+
+// Load reads every NN_name.up.sql / NN_name.down.sql pair in fsys.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed reading migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed reading %s: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migration %s has no up file", m)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+// Up applies pending migrations in order, at most n of them when n > 0.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkDirty(applied); err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if n > 0 && len(done) == n {
+				break
+			}
+			if err := m.apply(ctx, conn, mig); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the n most recently applied migrations (at least one).
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkDirty(applied); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Force marks every migration up to version as applied and clean and every
+// later one as not applied, without running any SQL. It adopts databases
+// built before schema_migrations existed and clears a dirty version once
+// it has been repaired by hand.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version > ?", version); err != nil {
+			return fmt.Errorf("failed forcing version %d: %w", version, err)
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			_, err := conn.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, 0, ?)
+				 ON DUPLICATE KEY UPDATE dirty = 0`,
+				mig.Version, mig.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("failed forcing version %d: %w", version, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Status lists every known migration and whether it is applied. Versions
+// recorded in the database without a file are listed too.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed connecting: %w", err)
+	}
+	defer conn.Close()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if row, ok := applied[mig.Version]; ok {
+			at := row.appliedAt
+			s.Applied, s.Dirty, s.AppliedAt = true, row.dirty, &at
+			delete(applied, mig.Version)
+		}
+		out = append(out, s)
+	}
+	for version, row := range applied {
+		at := row.appliedAt
+		out = append(out, Status{Version: version, Name: row.name, Applied: true, Dirty: row.dirty, AppliedAt: &at})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Pending returns the migrations not applied yet, or ErrDirty if a previous
+// run failed halfway.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		byVersion[mig.Version] = mig
+	}
+
+	var pending []Migration
+	for _, s := range statuses {
+		if s.Dirty {
+			return nil, fmt.Errorf("%w at version %d", ErrDirty, s.Version)
+		}
+		if !s.Applied {
+			pending = append(pending, byVersion[s.Version])
+		}
+	}
+	return pending, nil
+}
+
+// Create writes an up/down pair holding only a header comment, numbered
+// after the highest version in dir, and returns the two paths.
+func Create(dir, name string) (string, string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), "_")
+	if name == "" {
+		return "", "", errors.New("migration name is required")
+	}
+
+	ms, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var next int64 = 1
+	if len(ms) > 0 {
+		next = ms[len(ms)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%02d_%s", next, name))
+	up, down := base+".up.sql", base+".down.sql"
+	for _, p := range []string{up, down} {
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", fmt.Errorf("failed creating %s: %w", p, err)
+		}
+		_, err = fmt.Fprintf(f, "-- %s\n", filepath.Base(p))
+		f.Close()
+		if err != nil {
+			return "", "", fmt.Errorf("failed creating %s: %w", p, err)
+		}
+	}
+	return up, down, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	if _, err := conn.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, 1, ?)",
+		mig.Version, mig.Name, time.Now()); err != nil {
+		return fmt.Errorf("failed recording migration %s: %w", mig, err)
+	}
+	if err := execAll(ctx, conn, mig.Up); err != nil {
+		return fmt.Errorf("migration %s failed and is left dirty: %w", mig, err)
+	}
+	if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = 0 WHERE version = ?", mig.Version); err != nil {
+		return fmt.Errorf("failed recording migration %s: %w", mig, err)
+	}
+	log.Printf("[migrate] applied %s", mig)
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	if strings.TrimSpace(mig.Down) == "" {
+		return fmt.Errorf("migration %s has no down file", mig)
+	}
+	if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = 1 WHERE version = ?", mig.Version); err != nil {
+		return fmt.Errorf("failed recording migration %s: %w", mig, err)
+	}
+	if err := execAll(ctx, conn, mig.Down); err != nil {
+		return fmt.Errorf("reverting %s failed and left it dirty: %w", mig, err)
+	}
+	if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+		return fmt.Errorf("failed recording migration %s: %w", mig, err)
+	}
+	log.Printf("[migrate] reverted %s", mig)
+	return nil
+}
+
+// locked runs fn on one connection holding the migration lock, so two
+// instances starting together do not apply the same version twice.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed connecting: %w", err)
+	}
+	defer conn.Close()
+
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", lockName).Scan(&got); err != nil {
+		return fmt.Errorf("failed acquiring migration lock: %w", err)
+	}
+	if got.Int64 != 1 {
+		return errors.New("timed out waiting for the migration lock")
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `schema_migrations` ("+
+		"`version` bigint(20) NOT NULL,"+
+		"`name` varchar(191) NOT NULL,"+
+		"`dirty` tinyint(1) NOT NULL DEFAULT 0,"+
+		"`applied_at` datetime(3) NOT NULL,"+
+		"PRIMARY KEY (`version`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=latin1")
+	if err != nil {
+		return fmt.Errorf("failed creating schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedRow, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedRow)
+	for rows.Next() {
+		var (
+			version int64
+			row     appliedRow
+		)
+		if err := rows.Scan(&version, &row.name, &row.dirty, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed reading schema_migrations: %w", err)
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+func checkDirty(applied map[int64]appliedRow) error {
+	for version, row := range applied {
+		if row.dirty {
+			return fmt.Errorf("%w at version %d: repair it by hand, then run `migrate force <version>`", ErrDirty, version)
+		}
+	}
+	return nil
+}
+
+// execAll runs a migration one statement at a time; the MySQL driver only
+// accepts several per Exec with multiStatements enabled. Statements end with
+// a semicolon at the end of a line; full-line -- comments are dropped.
+func execAll(ctx context.Context, conn *sql.Conn, src string) error {
+	var stmt strings.Builder
+	flush := func() error {
+		s := strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";")
+		stmt.Reset()
+		if s == "" {
+			return nil
+		}
+		_, err := conn.ExecContext(ctx, s)
+		return err
+	}
+
+	for _, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteByte('\n')
+		if strings.HasSuffix(trimmed, ";") {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
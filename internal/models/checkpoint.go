@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	// CheckpointAggregating: transactions up to the cursor are summed in
+	// Aggregates; nothing has been written yet.
+	CheckpointAggregating = "aggregating"
+	// CheckpointWritten: the run's settlement versions, promotion and
+	// watermark are committed; the export may be partly written.
+	CheckpointWritten = "written"
+	// CheckpointExported: the CSV is complete.
+	CheckpointExported = "exported"
+)
+
+// SettlementCheckpoint is how far a settlement job got, so a job resumed
+// after a shutdown or a lost worker continues instead of starting over.
+type SettlementCheckpoint struct {
+	JobID string `gorm:"primaryKey;size:191" json:"job_id"`
+	Stage string `gorm:"size:32;not null" json:"stage"`
+	// Start is where the run began reading, Cursor the last transaction
+	// aggregated. Both are nil at the start of a stream.
+	StartPaidAt  *time.Time `json:"start_paid_at,omitempty"`
+	StartTxnID   uint64     `json:"start_txn_id"`
+	CursorPaidAt *time.Time `json:"cursor_paid_at,omitempty"`
+	CursorTxnID  uint64     `json:"cursor_txn_id"`
+	Total        int64      `json:"total"`
+	Processed    int64      `json:"processed"`
+	// Shards is the JSON of the run's day shards and their own cursors.
+	Shards string `gorm:"type:longtext" json:"-"`
+	// Aggregates is the JSON of the partial []Settlement summed so far.
+	Aggregates string `gorm:"type:longtext" json:"-"`
+	// ExportRows CSV rows, ending at byte ExportOffset, are on disk.
+	ExportRows   int64     `json:"export_rows"`
+	ExportOffset int64     `json:"export_offset"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DateLayout is how the API and job payloads write a day.
+const DateLayout = "2006-01-02"
+
+// ParseDate parses a day as its midnight in time.Local, which main sets to
+// the configured timezone: the zone the database connection reads and
+// writes times in. A day parsed as UTC midnight would be shifted by the
+// zone's offset.
+func ParseDate(s string) (time.Time, error) {
+	return time.ParseInLocation(DateLayout, s, time.Local)
+}
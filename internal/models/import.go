@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// TransactionImport is one uploaded transaction file, keyed by the SHA-256
+// of its content so the same file is only imported once.
+type TransactionImport struct {
+	SHA256     string    `gorm:"primaryKey;size:64" json:"sha256"`
+	JobID      string    `gorm:"size:191" json:"job_id"`
+	Filename   string    `gorm:"size:255" json:"filename"`
+	Format     string    `gorm:"size:16" json:"format"`
+	TotalRows  int64     `json:"total_rows"`
+	Inserted   int64     `json:"inserted"`
+	Duplicates int64     `json:"duplicates"`
+	Rejected   int64     `json:"rejected"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -1,17 +1,106 @@
-// internal/models/job.go
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// JobStatus is where a job is in its lifecycle. Only the moves listed in
+// jobTransitions are allowed; the repository refuses the rest.
+type JobStatus string
+
+const (
+	JobQueued               JobStatus = "QUEUED"
+	JobRunning              JobStatus = "RUNNING"
+	JobFinished             JobStatus = "FINISHED"
+	JobFinishedWithWarnings JobStatus = "FINISHED_WITH_WARNINGS"
+	JobFailed               JobStatus = "FAILED"
+	JobCanceled             JobStatus = "CANCELED"
+	JobInterrupted          JobStatus = "INTERRUPTED"
+)
+
+// jobTransitions maps a status to the ones it may move to. RUNNING to
+// RUNNING is a reclaim after the owner's lease ran out. Statuses without
+// an entry are terminal.
+var jobTransitions = map[JobStatus][]JobStatus{
+	JobQueued:      {JobRunning, JobCanceled},
+	JobRunning:     {JobRunning, JobFinished, JobFinishedWithWarnings, JobFailed, JobCanceled, JobInterrupted},
+	JobInterrupted: {JobRunning, JobCanceled},
+}
+
+// Valid reports whether s is a known status.
+func (s JobStatus) Valid() bool {
+	switch s {
+	case JobQueued, JobRunning, JobFinished, JobFinishedWithWarnings, JobFailed, JobCanceled, JobInterrupted:
+		return true
+	}
+	return false
+}
+
+// IsTerminal reports whether a job in s will not change again.
+func (s JobStatus) IsTerminal() bool {
+	return s.Valid() && len(jobTransitions[s]) == 0
+}
+
+// CanTransitionTo reports whether a job in s may move to next.
+func (s JobStatus) CanTransitionTo(next JobStatus) bool {
+	for _, to := range jobTransitions[s] {
+		if to == next {
+			return true
+		}
+	}
+	return false
+}
+
+// JobStatusesBefore lists the statuses a job may be in to move to next.
+func JobStatusesBefore(next JobStatus) []JobStatus {
+	var out []JobStatus
+	for from, tos := range jobTransitions {
+		for _, to := range tos {
+			if to == next {
+				out = append(out, from)
+			}
+		}
+	}
+	return out
+}
+
+// Job is a background job of any type, from enqueue to its terminal status.
+// It is stored in job_records.
 type Job struct {
-	ID         string     `json:"job_id" gorm:"primaryKey"`
-	Status     string     `json:"status" gorm:"default:QUEUED"`
-	Progress   int        `json:"progress"`
-	Processed  int        `json:"processed"`
-	Total      int        `json:"total"`
-	ResultPath string     `json:"result_path,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
-	Cancelled  bool       `json:"cancelled"`
-	CanceledAt *time.Time `json:"canceled_at,omitempty"`
+	ID     string    `json:"job_id"`
+	Status JobStatus `json:"status"`
+	// Type selects the handler; Payload is its normalized JSON input.
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	Progress   int    `json:"progress"`
+	Processed  int64  `json:"processed"`
+	Total      int64  `json:"total"`
+	Phase      string `json:"phase,omitempty"`
+	EtaSeconds int64  `json:"eta_seconds"`
+	ResultPath string `json:"result_path"`
+	// Error is why a FAILED job failed.
+	Error string `json:"error,omitempty"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Cancelled bool       `json:"cancelled"`
+	CancelAt  *time.Time `json:"cancel_at,omitempty"`
+
+	// CallbackURL is notified when the job ends; the secret signs the call.
+	CallbackURL    string `json:"callback_url,omitempty"`
+	CallbackSecret string `json:"-"`
+
+	// Queue, Tenant and Priority order QUEUED jobs across instances.
+	Queue    string `json:"queue"`
+	Tenant   string `json:"tenant"`
+	Priority int    `json:"priority"`
+
+	// Owner is the instance running the job; it holds the job while it keeps
+	// LeaseUntil in the future. Attempts counts claims, including reclaims.
+	Owner       string     `json:"owner,omitempty"`
+	LeaseUntil  *time.Time `json:"lease_until,omitempty"`
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+	Attempts    int        `json:"attempts"`
 }
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+var allJobStatuses = []JobStatus{
+	JobQueued, JobRunning, JobFinished, JobFinishedWithWarnings, JobFailed, JobCanceled, JobInterrupted,
+}
+
+func TestJobStatusTransitions(t *testing.T) {
+	// Every allowed move; any pair not listed must be refused.
+	allowed := map[[2]JobStatus]bool{
+		{JobQueued, JobRunning}:  true,
+		{JobQueued, JobCanceled}: true,
+
+		{JobRunning, JobRunning}:              true, // reclaim after the lease ran out
+		{JobRunning, JobFinished}:             true,
+		{JobRunning, JobFinishedWithWarnings}: true,
+		{JobRunning, JobFailed}:               true,
+		{JobRunning, JobCanceled}:             true,
+		{JobRunning, JobInterrupted}:          true,
+
+		{JobInterrupted, JobRunning}:  true,
+		{JobInterrupted, JobCanceled}: true,
+	}
+
+	for _, from := range allJobStatuses {
+		for _, to := range allJobStatuses {
+			want := allowed[[2]JobStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s: CanTransitionTo = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	// Unknown statuses go nowhere and cannot be reached.
+	if JobStatus("DONE").CanTransitionTo(JobRunning) || JobQueued.CanTransitionTo("DONE") {
+		t.Error("unknown status takes part in a transition")
+	}
+}
+
+func TestJobStatusesBefore(t *testing.T) {
+	for _, to := range allJobStatuses {
+		var want []string
+		for _, from := range allJobStatuses {
+			if from.CanTransitionTo(to) {
+				want = append(want, string(from))
+			}
+		}
+		var got []string
+		for _, from := range JobStatusesBefore(to) {
+			got = append(got, string(from))
+		}
+		slices.Sort(want)
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("JobStatusesBefore(%s) = %v, want %v", to, got, want)
+		}
+	}
+	if got := JobStatusesBefore(JobQueued); len(got) != 0 {
+		t.Errorf("jobs can move back to QUEUED from %v", got)
+	}
+}
+
+func TestJobStatusIsTerminal(t *testing.T) {
+	tests := []struct {
+		status JobStatus
+		want   bool
+	}{
+		{JobQueued, false},
+		{JobRunning, false},
+		{JobInterrupted, false},
+		{JobFinished, true},
+		{JobFinishedWithWarnings, true},
+		{JobFailed, true},
+		{JobCanceled, true},
+		{JobStatus(""), false},
+		{JobStatus("DONE"), false},
+	}
+	for _, tt := range tests {
+		if got := tt.status.IsTerminal(); got != tt.want {
+			t.Errorf("%q.IsTerminal() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Merchant holds per-merchant settlement settings. Merchants without a row
+// are settled in the currency they were paid in.
+type Merchant struct {
+	ID                 uint64    `gorm:"primaryKey" json:"id"`
+	SettlementCurrency string    `gorm:"size:3;not null" json:"settlement_currency"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// FxRate is the number of QuoteCurrency units per one BaseCurrency unit,
+// valid from EffectiveFrom until a newer rate for the same pair takes over.
+type FxRate struct {
+	ID            uint64    `gorm:"primaryKey" json:"id"`
+	BaseCurrency  string    `gorm:"size:3;not null;index:idx_fx_pair_effective,priority:1" json:"base_currency"`
+	QuoteCurrency string    `gorm:"size:3;not null;index:idx_fx_pair_effective,priority:2" json:"quote_currency"`
+	Rate          string    `gorm:"type:decimal(24,12);not null" json:"rate"`
+	EffectiveFrom time.Time `gorm:"not null;index:idx_fx_pair_effective,priority:3" json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// DailyTotal is a per merchant per day per currency aggregate used to compare
+// transactions against the settlements written for the same period.
+type DailyTotal struct {
+	MerchantID uint64    `json:"merchant_id"`
+	Date       time.Time `json:"date"`
+	Currency   string    `json:"currency"`
+	TxnCount   int64     `json:"txn_count"`
+	GrossCents int64     `json:"gross_cents"`
+	FeeCents   int64     `json:"fee_cents"`
+}
+
+// Reconciliation stores one discrepancy found after a settlement run.
+type Reconciliation struct {
+	ID                 uint64    `gorm:"primaryKey" json:"id"`
+	JobID              string    `gorm:"size:191;index" json:"job_id"`
+	MerchantID         uint64    `json:"merchant_id"`
+	Date               time.Time `json:"date"`
+	Currency           string    `gorm:"size:3" json:"currency"`
+	ExpectedCount      int64     `json:"expected_count"`
+	SettledCount       int64     `json:"settled_count"`
+	ExpectedGrossCents int64     `json:"expected_gross_cents"`
+	SettledGrossCents  int64     `json:"settled_gross_cents"`
+	ExpectedFeeCents   int64     `json:"expected_fee_cents"`
+	SettledFeeCents    int64     `json:"settled_fee_cents"`
+	CreatedAt          time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Schedule enqueues a settlement job whenever CronExpr fires in Timezone.
+// The settled period is relative to the fire date: FromOffsetDays = -1 and
+// ToOffsetDays = -1 settles "yesterday".
+type Schedule struct {
+	ID              uint64     `gorm:"primaryKey" json:"id"`
+	Name            string     `gorm:"size:191;uniqueIndex" json:"name"`
+	CronExpr        string     `gorm:"size:100;not null" json:"cron_expr"`
+	Timezone        string     `gorm:"size:64;not null" json:"timezone"`
+	FromOffsetDays  int        `json:"from_offset_days"`
+	ToOffsetDays    int        `json:"to_offset_days"`
+	ConvertCurrency bool       `json:"convert_currency"`
+	Mode            string     `gorm:"size:16;not null;default:full" json:"mode"`
+	Enabled         bool       `gorm:"index:idx_schedules_due,priority:1" json:"enabled"`
+	NextRunAt       time.Time  `gorm:"index:idx_schedules_due,priority:2" json:"next_run_at"`
+	LastRunAt       *time.Time `json:"last_run_at,omitempty"`
+	LastJobID       string     `gorm:"size:191" json:"last_job_id,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
@@ -2,14 +2,41 @@ package models
 
 import "time"
 
+// Settlement is one version of a merchant's daily aggregate in one currency.
+// Every run writes its own version; IsCurrent marks the one that is
+// authoritative. Amounts are in minor units of Currency; the Settled* fields
+// are only filled when the run converted into the merchant's settlement
+// currency.
 type Settlement struct {
-	ID          uint64    `gorm:"primaryKey" json:"id"`
-	MerchantID  uint64    `json:"merchant_id"`
-	Date        time.Time `json:"date"`
-	GrossCents  int64     `json:"gross_cents"`
-	FeeCents    int64     `json:"fee_cents"`
-	NetCents    int64     `json:"net_cents"`
-	TxnCount    int64     `json:"txn_count"`
-	GeneratedAt time.Time `json:"generated_at"`
-	RunID       string    `json:"run_id"`
+	ID                 uint64    `gorm:"primaryKey" json:"id"`
+	MerchantID         uint64    `gorm:"uniqueIndex:uk_merchant_date_run,priority:1" json:"merchant_id"`
+	Date               time.Time `gorm:"uniqueIndex:uk_merchant_date_run,priority:2" json:"date"`
+	Currency           string    `gorm:"size:3;not null;default:IDR;uniqueIndex:uk_merchant_date_run,priority:3" json:"currency"`
+	GrossCents         int64     `json:"gross_cents"`
+	FeeCents           int64     `json:"fee_cents"`
+	NetCents           int64     `json:"net_cents"`
+	TxnCount           int64     `json:"txn_count"`
+	SettlementCurrency string    `gorm:"size:3" json:"settlement_currency,omitempty"`
+	FxRate             string    `gorm:"size:32" json:"fx_rate,omitempty"`
+	SettledGrossCents  int64     `json:"settled_gross_cents,omitempty"`
+	SettledFeeCents    int64     `json:"settled_fee_cents,omitempty"`
+	SettledNetCents    int64     `json:"settled_net_cents,omitempty"`
+	GeneratedAt        time.Time `json:"generated_at"`
+	RunID              string    `gorm:"size:191;uniqueIndex:uk_merchant_date_run,priority:4" json:"run_id"`
+	Version            int       `gorm:"not null;default:1" json:"version"`
+	IsCurrent          bool      `gorm:"not null;default:false" json:"is_current"`
+}
+
+// SettlementDiff describes how one merchant/day/currency differs between two
+// runs. A nil side means the run did not produce that row.
+type SettlementDiff struct {
+	MerchantID      uint64      `json:"merchant_id"`
+	Date            time.Time   `json:"date"`
+	Currency        string      `json:"currency"`
+	A               *Settlement `json:"a"`
+	B               *Settlement `json:"b"`
+	GrossCentsDelta int64       `json:"gross_cents_delta"`
+	FeeCentsDelta   int64       `json:"fee_cents_delta"`
+	NetCentsDelta   int64       `json:"net_cents_delta"`
+	TxnCountDelta   int64       `json:"txn_count_delta"`
 }
@@ -2,11 +2,23 @@ package models
 
 import "time"
 
+const (
+	TxnPaid     = "paid"
+	TxnPending  = "pending"
+	TxnFailed   = "failed"
+	TxnRefunded = "refunded"
+)
+
+// Transaction amounts are in minor units of Currency. ExternalRef is the
+// payment processor's id; it is unique, so a pushed transaction is stored
+// once no matter how often it is sent. Seeded rows use seed-<seed>-<start>-<n>.
 type Transaction struct {
 	ID          uint64    `gorm:"primaryKey" json:"id"`
+	ExternalRef *string   `gorm:"size:191;uniqueIndex:uk_external_ref" json:"external_ref,omitempty"`
 	MerchantID  uint64    `json:"merchant_id"`
+	Currency    string    `gorm:"size:3;not null;default:IDR" json:"currency"`
 	AmountCents int64     `json:"amount_cents"`
 	FeeCents    int64     `json:"fee_cents"`
-	Status      string    `json:"status"`
+	Status      string    `gorm:"size:16" json:"status"`
 	PaidAt      time.Time `json:"paid_at"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// SettlementWatermark is the high-water mark of a settlement stream: every
+// transaction up to (LastPaidAt, LastTxnID) is reflected in the current
+// settlement versions.
+type SettlementWatermark struct {
+	Stream     string    `gorm:"primaryKey;size:64" json:"stream"`
+	LastPaidAt time.Time `json:"last_paid_at"`
+	LastTxnID  uint64    `json:"last_txn_id"`
+	RunID      string    `gorm:"size:191" json:"run_id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SettlementSpan is a period a full run settled ahead of its stream's
+// watermark, from FromPaidAt up to the last transaction it read. The
+// watermark jumps over it once every transaction before it is settled.
+type SettlementSpan struct {
+	ID         uint64    `gorm:"primaryKey" json:"id"`
+	Stream     string    `gorm:"size:64" json:"stream"`
+	FromPaidAt time.Time `json:"from_paid_at"`
+	LastPaidAt time.Time `json:"last_paid_at"`
+	LastTxnID  uint64    `json:"last_txn_id"`
+	RunID      string    `gorm:"size:191" json:"run_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
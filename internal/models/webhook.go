@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+	DeliveryPending   = "PENDING"
+	DeliveryDelivered = "DELIVERED"
+	DeliveryFailed    = "FAILED"
+)
+
+// WebhookSubscription receives a signed POST whenever a job reaches one of
+// Events (comma separated job statuses; empty means all terminal ones).
+type WebhookSubscription struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	URL       string    `gorm:"size:2048;not null" json:"url"`
+	Secret    string    `gorm:"size:128;not null" json:"secret,omitempty"`
+	Events    string    `gorm:"size:255" json:"events"`
+	Active    bool      `gorm:"not null;default:true" json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is one notification to one endpoint, kept for retries and
+// redelivery. SubscriptionID is nil for a job's own callback URL.
+type WebhookDelivery struct {
+	ID             uint64     `gorm:"primaryKey" json:"id"`
+	SubscriptionID *uint64    `gorm:"index" json:"subscription_id,omitempty"`
+	JobID          string     `gorm:"size:191;index" json:"job_id"`
+	Event          string     `gorm:"size:64" json:"event"`
+	URL            string     `gorm:"size:2048;not null" json:"url"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"size:16;index:idx_deliveries_due,priority:1" json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseCode   int        `json:"response_code"`
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+	NextAttemptAt  time.Time  `gorm:"index:idx_deliveries_due,priority:2" json:"next_attempt_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeDB answers the statements of a repository from a Go function instead
+// of MySQL, and records them, so tests can check what a repository sends
+// and how it reacts to what comes back.
+type fakeDB struct {
+	mu     sync.Mutex
+	answer func(q string, args []driver.Value) (fakeResult, error)
+	log    []fakeStmt
+}
+
+// fakeStmt is one statement as the driver received it. Tx tells BEGIN,
+// COMMIT and ROLLBACK apart from statements.
+type fakeStmt struct {
+	Query string
+	Args  []driver.Value
+	Tx    string
+}
+
+// fakeResult is what a statement returns: rows for queries, the affected
+// count for everything else.
+type fakeResult struct {
+	Columns  []string
+	Rows     [][]driver.Value
+	Affected int64
+}
+
+var (
+	fakeMu  sync.Mutex
+	fakeDBs = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+// newFakeDB returns a gorm handle whose statements go to answer.
+func newFakeDB(t *testing.T, answer func(q string, args []driver.Value) (fakeResult, error)) (*gorm.DB, *fakeDB) {
+	t.Helper()
+	f := &fakeDB{answer: answer}
+	fakeMu.Lock()
+	fakeDBs[t.Name()] = f
+	fakeMu.Unlock()
+
+	sqlDB, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB.Close()
+		fakeMu.Lock()
+		delete(fakeDBs, t.Name())
+		fakeMu.Unlock()
+	})
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, f
+}
+
+// statements returns the recorded statements whose query contains substr,
+// or all of them (including BEGIN/COMMIT) for "".
+func (f *fakeDB) statements(substr string) []fakeStmt {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []fakeStmt
+	for _, s := range f.log {
+		if substr == "" || (s.Tx == "" && strings.Contains(s.Query, substr)) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (f *fakeDB) run(q string, nv []driver.NamedValue) (fakeResult, error) {
+	args := make([]driver.Value, len(nv))
+	for i, v := range nv {
+		args[i] = v.Value
+	}
+	f.mu.Lock()
+	f.log = append(f.log, fakeStmt{Query: q, Args: args})
+	f.mu.Unlock()
+	if strings.HasPrefix(strings.TrimSpace(q), "SAVEPOINT") || strings.HasPrefix(strings.TrimSpace(q), "RELEASE SAVEPOINT") {
+		return fakeResult{}, nil
+	}
+	return f.answer(q, args)
+}
+
+func (f *fakeDB) tx(what string) {
+	f.mu.Lock()
+	f.log = append(f.log, fakeStmt{Tx: what})
+	f.mu.Unlock()
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	f, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("fakedb %q not registered", name)
+	}
+	return &fakeConn{db: f}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakedb: prepared statements are not supported")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.tx("BEGIN")
+	return fakeTx{c.db}, nil
+}
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Begin()
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(res.Affected), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{cols: res.Columns, rows: res.Rows}, nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (t fakeTx) Commit() error   { t.db.tx("COMMIT"); return nil }
+func (t fakeTx) Rollback() error { t.db.tx("ROLLBACK"); return nil }
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
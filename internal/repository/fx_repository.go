@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"indico-be/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type Merchant struct {
+	models.Merchant
+}
+
+type FxRate struct {
+	models.FxRate
+}
+
+// ErrRateNotFound is returned when no rate is effective for a pair at a date.
+var ErrRateNotFound = errors.New("fx rate not found")
+
+type FxRepository interface {
+	SettlementCurrencies(ctx context.Context) (map[uint64]string, error)
+	SetSettlementCurrency(ctx context.Context, merchantID uint64, currency string) error
+	CreateRate(ctx context.Context, rate *models.FxRate) error
+	ListRates(ctx context.Context, base, quote string) ([]models.FxRate, error)
+	RateAt(ctx context.Context, base, quote string, at time.Time) (*models.FxRate, error)
+}
+
+type fxRepo struct {
+	db *gorm.DB
+}
+
+func NewFxRepo(db *gorm.DB) FxRepository {
+	return &fxRepo{db: db}
+}
+
+func (r *fxRepo) SettlementCurrencies(ctx context.Context) (map[uint64]string, error) {
+	var merchants []models.Merchant
+	if err := r.db.WithContext(ctx).Find(&merchants).Error; err != nil {
+		return nil, fmt.Errorf("gagal mengambil merchant: %w", err)
+	}
+	out := make(map[uint64]string, len(merchants))
+	for _, m := range merchants {
+		out[m.ID] = m.SettlementCurrency
+	}
+	return out, nil
+}
+
+func (r *fxRepo) SetSettlementCurrency(ctx context.Context, merchantID uint64, currency string) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).Exec(`
+		INSERT INTO merchants (id, settlement_currency, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			settlement_currency = VALUES(settlement_currency),
+			updated_at = VALUES(updated_at)
+	`, merchantID, currency, now, now).Error
+}
+
+func (r *fxRepo) CreateRate(ctx context.Context, rate *models.FxRate) error {
+	return r.db.WithContext(ctx).Create(rate).Error
+}
+
+func (r *fxRepo) ListRates(ctx context.Context, base, quote string) ([]models.FxRate, error) {
+	var rates []models.FxRate
+	q := r.db.WithContext(ctx)
+	if base != "" {
+		q = q.Where("base_currency = ?", base)
+	}
+	if quote != "" {
+		q = q.Where("quote_currency = ?", quote)
+	}
+	err := q.Order("base_currency, quote_currency, effective_from DESC").Find(&rates).Error
+	return rates, err
+}
+
+// RateAt returns the latest rate for base→quote that is effective at `at`.
+func (r *fxRepo) RateAt(ctx context.Context, base, quote string, at time.Time) (*models.FxRate, error) {
+	var rate models.FxRate
+	err := r.db.WithContext(ctx).
+		Where("base_currency = ? AND quote_currency = ? AND effective_from <= ?", base, quote, at).
+		Order("effective_from DESC").
+		First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s→%s at %s", ErrRateNotFound, base, quote, at.Format("2006-01-02"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"indico-be/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TransactionImport struct {
+	models.TransactionImport
+}
+
+type ImportRepository interface {
+	// Create stores imp and the QUEUED job importing it in one transaction,
+	// unless the content hash is already known; false means another upload
+	// of the same file got there first.
+	Create(ctx context.Context, imp *models.TransactionImport, job *models.Job) (bool, error)
+	Get(ctx context.Context, sha256 string) (*models.TransactionImport, error)
+	// Replace points the import at job, stored in the same transaction, as
+	// long as it still points at prevJobID; false means another upload
+	// replaced it first.
+	Replace(ctx context.Context, sha256, prevJobID string, job *models.Job) (bool, error)
+	SaveResult(ctx context.Context, sha256 string, total, inserted, duplicates, rejected int64) error
+}
+
+type importRepo struct {
+	db *gorm.DB
+}
+
+func NewImportRepo(db *gorm.DB) ImportRepository {
+	return &importRepo{db: db}
+}
+
+func (r *importRepo) Create(ctx context.Context, imp *models.TransactionImport, job *models.Job) (bool, error) {
+	imp.JobID = job.ID
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(imp)
+		if res.Error != nil || res.RowsAffected != 1 {
+			return res.Error
+		}
+		created = true
+		return (&jobRepo{db: tx}).Create(ctx, job)
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+func (r *importRepo) Get(ctx context.Context, sha256 string) (*models.TransactionImport, error) {
+	var imp models.TransactionImport
+	if err := r.db.WithContext(ctx).Where("sha256 = ?", sha256).First(&imp).Error; err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+func (r *importRepo) Replace(ctx context.Context, sha256, prevJobID string, job *models.Job) (bool, error) {
+	replaced := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.TransactionImport{}).
+			Where("sha256 = ? AND job_id = ?", sha256, prevJobID).
+			Updates(map[string]interface{}{"job_id": job.ID, "updated_at": time.Now()})
+		if res.Error != nil || res.RowsAffected != 1 {
+			return res.Error
+		}
+		replaced = true
+		return (&jobRepo{db: tx}).Create(ctx, job)
+	})
+	if err != nil {
+		return false, err
+	}
+	return replaced, nil
+}
+
+func (r *importRepo) SaveResult(ctx context.Context, sha256 string, total, inserted, duplicates, rejected int64) error {
+	return r.db.WithContext(ctx).Model(&models.TransactionImport{}).
+		Where("sha256 = ?", sha256).
+		Updates(map[string]interface{}{
+			"total_rows": total,
+			"inserted":   inserted,
+			"duplicates": duplicates,
+			"rejected":   rejected,
+			"updated_at": time.Now(),
+		}).Error
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"indico-be/internal/models"
+)
+
+// TestImportStoredWithJob checks that an import row is never created or
+// handed over without the insert of its job.
+func TestImportStoredWithJob(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		matched  int64 // rows the import insert or update matches
+		replace  bool
+		want     bool
+		wantStmt string
+	}{
+		{"created", 1, false, true, "BEGIN IMPORT JOB COMMIT"},
+		{"already registered", 0, false, false, "BEGIN IMPORT COMMIT"},
+		{"handed over", 1, true, true, "BEGIN IMPORT JOB COMMIT"},
+		{"handed over elsewhere first", 0, true, false, "BEGIN IMPORT COMMIT"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, func(q string, args []driver.Value) (fakeResult, error) {
+				if strings.Contains(q, "job_records") {
+					return fakeResult{Affected: 1}, nil
+				}
+				return fakeResult{Affected: tc.matched}, nil
+			})
+			repo := NewImportRepo(db)
+			ctx := context.Background()
+			job := &models.Job{ID: "job-2", Type: "transaction_import", Status: models.JobQueued}
+
+			var (
+				got bool
+				err error
+			)
+			if tc.replace {
+				got, err = repo.Replace(ctx, "abc", "job-1", job)
+			} else {
+				imp := &models.TransactionImport{SHA256: "abc", Filename: "a.csv", Format: "csv"}
+				got, err = repo.Create(ctx, imp, job)
+				if imp.JobID != job.ID {
+					t.Errorf("import job_id = %q, want %q", imp.JobID, job.ID)
+				}
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("got %v, %v; want %v", got, err, tc.want)
+			}
+
+			var stmts []string
+			for _, s := range fake.statements("") {
+				switch {
+				case s.Tx != "":
+					stmts = append(stmts, s.Tx)
+				case strings.Contains(s.Query, "transaction_imports"):
+					stmts = append(stmts, "IMPORT")
+					if tc.replace && (!strings.Contains(s.Query, "job_id = ?") || s.Args[len(s.Args)-1] != "job-1") {
+						t.Errorf("hand-over does not check the previous job: %s %v", s.Query, s.Args)
+					}
+				case strings.Contains(s.Query, "INSERT INTO job_records"):
+					stmts = append(stmts, "JOB")
+				}
+			}
+			if strings.Join(stmts, " ") != tc.wantStmt {
+				t.Errorf("statements = %v, want %s", stmts, tc.wantStmt)
+			}
+		})
+	}
+}
@@ -2,33 +2,134 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
+	"indico-be/internal/models"
+
 	"gorm.io/gorm"
 )
 
-type JobRecord struct {
-	ID         string     `gorm:"primaryKey" json:"job_id"`
-	Status     string     `json:"status"`   
-	Progress   int        `json:"progress"`
-	Processed  int64      `json:"processed"`
-	Total      int64      `json:"total"`
-	ResultPath string     `json:"result_path"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
-	Cancelled  bool       `json:"cancelled"`
-	CancelAt   *time.Time `json:"cancel_at,omitempty"`
+// jobRecord is the persistence mapping of models.Job onto job_records.
+type jobRecord struct {
+	ID             string `gorm:"primaryKey"`
+	Status         string
+	Progress       int
+	Processed      int64
+	Total          int64
+	Phase          string `gorm:"size:32"`
+	EtaSeconds     int64
+	ResultPath     string
+	Error          string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Cancelled      bool
+	CancelAt       *time.Time
+	CallbackURL    string          `gorm:"size:2048"`
+	CallbackSecret string          `gorm:"size:128"`
+	Type           string          `gorm:"size:64;default:settlement"`
+	Payload        json.RawMessage `gorm:"type:json"`
+	Queue          string          `gorm:"size:64"`
+	Tenant         string          `gorm:"size:191"`
+	Priority       int
+	Owner          string `gorm:"size:191"`
+	LeaseUntil     *time.Time
+	HeartbeatAt    *time.Time
+	Attempts       int
 }
 
+func (jobRecord) TableName() string { return "job_records" }
+
+func (r *jobRecord) model() models.Job {
+	return models.Job{
+		ID:             r.ID,
+		Status:         models.JobStatus(r.Status),
+		Type:           r.Type,
+		Payload:        r.Payload,
+		Progress:       r.Progress,
+		Processed:      r.Processed,
+		Total:          r.Total,
+		Phase:          r.Phase,
+		EtaSeconds:     r.EtaSeconds,
+		ResultPath:     r.ResultPath,
+		Error:          r.Error,
+		CreatedAt:      r.CreatedAt,
+		UpdatedAt:      r.UpdatedAt,
+		Cancelled:      r.Cancelled,
+		CancelAt:       r.CancelAt,
+		CallbackURL:    r.CallbackURL,
+		CallbackSecret: r.CallbackSecret,
+		Queue:          r.Queue,
+		Tenant:         r.Tenant,
+		Priority:       r.Priority,
+		Owner:          r.Owner,
+		LeaseUntil:     r.LeaseUntil,
+		HeartbeatAt:    r.HeartbeatAt,
+		Attempts:       r.Attempts,
+	}
+}
+
+// ErrInvalidTransition is returned when a job's current status does not
+// allow the requested one, e.g. finishing a job that was cancelled.
+var ErrInvalidTransition = errors.New("invalid job status transition")
+
+// claimable matches jobs nobody holds: queued ones, ones interrupted by a
+// shutdown or waiting out a retry delay that is over, and running ones
+// whose owner stopped renewing its lease (or never had one, from before
+// leases existed).
+const claimable = "(status = 'QUEUED' OR (status IN ('INTERRUPTED', 'RUNNING') AND (lease_until IS NULL OR lease_until < ?)))"
+
 type JobRepository interface {
-	Create(ctx context.Context, job *JobRecord) error
-	UpdateStatus(ctx context.Context, id string, status string) error
-	GetByID(ctx context.Context, id string) (*JobRecord, error)
+	Create(ctx context.Context, job *models.Job) error
+	// CreateClaimed stores a new job already claimed by owner, so no other
+	// instance can take it.
+	CreateClaimed(ctx context.Context, job *models.Job, owner string, leaseUntil time.Time) error
+	// UpdateStatus moves a job to status if its current status allows it,
+	// and returns ErrInvalidTransition otherwise.
+	UpdateStatus(ctx context.Context, id string, status models.JobStatus) error
+	GetByID(ctx context.Context, id string) (*models.Job, error)
+	// MarkCancelled cancels a job that has not ended yet.
 	MarkCancelled(ctx context.Context, id string) error
-	UpdateJob(ctx context.Context, job *JobRecord) error
 	UpdateTotal(ctx context.Context, jobID string, total int64) error
-	UpdateProgress(ctx context.Context, jobID string, processed int, progress int) error
-	IncrementProcessed(ctx context.Context, id string, inc int64, progress float64) error
+	UpdateProgress(ctx context.Context, jobID string, p Progress) error
+	// ListClaimable returns the oldest claimable job of every queue/tenant,
+	// highest priority first.
+	ListClaimable(ctx context.Context, now time.Time) ([]models.Job, error)
+	// Claim takes a claimable job for owner; false means another instance
+	// got it first.
+	Claim(ctx context.Context, id, owner string, now, leaseUntil time.Time) (bool, error)
+	// Heartbeat extends owner's lease; false means the job was cancelled or
+	// reclaimed and owner must stop.
+	Heartbeat(ctx context.Context, id, owner string, leaseUntil time.Time) (bool, error)
+	// Finish stores the terminal status of a job owner still holds, with
+	// errMsg when it failed.
+	Finish(ctx context.Context, id, owner string, status models.JobStatus, resultPath, errMsg string) (bool, error)
+	// Interrupt hands a job owner still holds back to the queue as
+	// INTERRUPTED.
+	Interrupt(ctx context.Context, id, owner string) (bool, error)
+	// Retry hands a failed job owner still holds back as INTERRUPTED, to be
+	// claimed again after retryAt. The attempt stays counted.
+	Retry(ctx context.Context, id, owner string, retryAt time.Time, errMsg string) (bool, error)
+	CountQueued(ctx context.Context, queue string) (int64, error)
+	QueuedByTenant(ctx context.Context) ([]QueuedCount, error)
+}
+
+// QueuedCount is the number of QUEUED jobs of one tenant in one queue.
+type QueuedCount struct {
+	Queue  string
+	Tenant string
+	Count  int
+}
+
+// Progress is a snapshot of a running job. Processed counts transactions
+// aggregated so far; Progress is the overall percentage across phases.
+type Progress struct {
+	Processed  int64
+	Progress   int
+	Phase      string
+	EtaSeconds int64
 }
 
 type jobRepo struct {
@@ -39,90 +140,208 @@ func NewJobRepository(db *gorm.DB) JobRepository {
 	return &jobRepo{db: db}
 }
 
-func (r *jobRepo) Create(ctx context.Context, job *JobRecord) error {
+// Create stores a new job. Jobs always start QUEUED.
+func (r *jobRepo) Create(ctx context.Context, job *models.Job) error {
+	if job.Status != models.JobQueued {
+		return fmt.Errorf("%w: new job %s cannot start %s", ErrInvalidTransition, job.ID, job.Status)
+	}
 	return r.db.WithContext(ctx).Exec(`
 		INSERT INTO job_records (
-			id, status, progress, processed, total, result_path, created_at, updated_at, cancelled, cancel_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE
-			status = VALUES(status),
-			updated_at = VALUES(updated_at),
-			progress = VALUES(progress),
-			processed = VALUES(processed),
-			total = VALUES(total),
-			result_path = VALUES(result_path)
-	`, job.ID, job.Status, job.Progress, job.Processed, job.Total, job.ResultPath, job.CreatedAt, job.UpdatedAt, job.Cancelled, job.CancelAt).Error
+			id, type, payload, status, progress, processed, total, result_path, created_at, updated_at, cancelled, cancel_at,
+			callback_url, callback_secret, queue, tenant, priority
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.Type, []byte(job.Payload), job.Status, job.Progress, job.Processed, job.Total, job.ResultPath, job.CreatedAt, job.UpdatedAt, job.Cancelled, job.CancelAt,
+		job.CallbackURL, job.CallbackSecret, job.Queue, job.Tenant, job.Priority).Error
+}
+
+// CreateClaimed creates and claims the job in one transaction; other
+// instances never see it QUEUED.
+func (r *jobRepo) CreateClaimed(ctx context.Context, job *models.Job, owner string, leaseUntil time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := &jobRepo{db: tx}
+		if err := repo.Create(ctx, job); err != nil {
+			return err
+		}
+		won, err := repo.Claim(ctx, job.ID, owner, time.Now(), leaseUntil)
+		if err != nil {
+			return err
+		}
+		if !won {
+			return fmt.Errorf("failed claiming new job %s", job.ID)
+		}
+		return nil
+	})
 }
 
-func (r *jobRepo) UpdateStatus(ctx context.Context, id string, status string) error {
-	return r.db.WithContext(ctx).Model(&JobRecord{}).Where("id = ?", id).Update("status", status).Error
+// transition applies updates to job id only while its status may move to
+// status, and explains a refusal.
+func (r *jobRepo) transition(ctx context.Context, id string, status models.JobStatus, updates map[string]interface{}) error {
+	updates["status"] = status
+	updates["updated_at"] = time.Now()
+	res := r.db.WithContext(ctx).Model(&jobRecord{}).
+		Where("id = ? AND status IN ?", id, models.JobStatusesBefore(status)).
+		Updates(updates)
+	if res.Error != nil || res.RowsAffected == 1 {
+		return res.Error
+	}
+
+	current, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: job %s is %s, cannot become %s", ErrInvalidTransition, id, current.Status, status)
 }
 
-func (r *jobRepo) GetByID(ctx context.Context, id string) (*JobRecord, error) {
-	var job JobRecord
-	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&job).Error; err != nil {
+func (r *jobRepo) UpdateStatus(ctx context.Context, id string, status models.JobStatus) error {
+	return r.transition(ctx, id, status, map[string]interface{}{})
+}
+
+func (r *jobRepo) GetByID(ctx context.Context, id string) (*models.Job, error) {
+	var rec jobRecord
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&rec).Error; err != nil {
 		return nil, err
 	}
-	if job.Status == "FINISHED" {
+	job := rec.model()
+	// Settlement jobs finished before result paths were stored.
+	if job.ResultPath == "" && job.Type == "settlement" && (job.Status == models.JobFinished || job.Status == models.JobFinishedWithWarnings) {
 		job.ResultPath = "/public/downloads/" + job.ID + ".csv"
 	}
 	return &job, nil
 }
 
 func (r *jobRepo) MarkCancelled(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Model(&JobRecord{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"cancelled":  true,
-		"status":     "CANCELED",
-		"updated_at": time.Now(),
-	}).Error
-}
-
-func (r *jobRepo) UpdateJob(ctx context.Context, job *JobRecord) error {
-	// Pastikan status dan timestamp benar
-	job.UpdatedAt = time.Now()
-
-	return r.db.WithContext(ctx).
-		Model(&JobRecord{}).
-		Where("id = ?", job.ID).
-		Updates(map[string]interface{}{
-			"progress":   job.Progress,
-			"processed":  job.Processed,
-			"total":      job.Total,
-			"status":     job.Status,
-			"updated_at": job.UpdatedAt,
-		}).Error
+	return r.transition(ctx, id, models.JobCanceled, map[string]interface{}{
+		"cancelled": true,
+		"cancel_at": time.Now(),
+	})
 }
 
 func (r *jobRepo) UpdateTotal(ctx context.Context, jobID string, total int64) error {
 	return r.db.WithContext(ctx).
-		Model(&JobRecord{}).
+		Model(&jobRecord{}).
 		Where("id = ?", jobID).
 		Update("total", total).Error
 }
 
-func (r *jobRepo) UpdateProgress(
-	ctx context.Context,
-	jobID string,
-	processed int,
-	progress int,
-) error {
+// UpdateProgress never lowers the stored percentage, so a late or repeated
+// write cannot make progress go backwards.
+func (r *jobRepo) UpdateProgress(ctx context.Context, jobID string, p Progress) error {
 	return r.db.WithContext(ctx).
-		Model(&JobRecord{}).
-		Where("id = ?", jobID).
+		Model(&jobRecord{}).
+		Where("id = ? AND progress <= ?", jobID, p.Progress).
 		Updates(map[string]interface{}{
-			"processed":  processed,
-			"progress":   progress,
-			"updated_at": time.Now(),
+			"processed":   p.Processed,
+			"progress":    p.Progress,
+			"phase":       p.Phase,
+			"eta_seconds": p.EtaSeconds,
+			"updated_at":  time.Now(),
 		}).Error
 }
 
-func (r *jobRepo) IncrementProcessed(ctx context.Context, id string, inc int64, progress float64) error {
-	return r.db.WithContext(ctx).
-		Model(&JobRecord{}).
-		Where("id = ?", id).
+func (r *jobRepo) ListClaimable(ctx context.Context, now time.Time) ([]models.Job, error) {
+	var recs []jobRecord
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT j.* FROM job_records j
+		JOIN (
+			SELECT queue, tenant, MIN(created_at) AS created_at
+			FROM job_records
+			WHERE `+claimable+`
+			GROUP BY queue, tenant
+		) head ON head.queue = j.queue AND head.tenant = j.tenant AND head.created_at = j.created_at
+		WHERE `+claimable+`
+		ORDER BY j.priority DESC, j.created_at, j.id
+	`, now, now).Scan(&recs).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.Job, len(recs))
+	for i := range recs {
+		out[i] = recs[i].model()
+	}
+	return out, nil
+}
+
+// Claim is a compare-and-set on the claimable condition, so it works on
+// MySQL versions without SKIP LOCKED and two instances never both win.
+func (r *jobRepo) Claim(ctx context.Context, id, owner string, now, leaseUntil time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Exec(`
+		UPDATE job_records
+		SET status = 'RUNNING', owner = ?, lease_until = ?, heartbeat_at = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = ? AND `+claimable,
+		owner, leaseUntil, now, now, id, now)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *jobRepo) Heartbeat(ctx context.Context, id, owner string, leaseUntil time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&jobRecord{}).
+		Where("id = ? AND owner = ? AND status = 'RUNNING'", id, owner).
 		Updates(map[string]interface{}{
-			"processed":  gorm.Expr("processed + ?", inc),
-			"progress":   progress,
-			"updated_at": time.Now(),
-		}).Error
+			"lease_until":  leaseUntil,
+			"heartbeat_at": time.Now(),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *jobRepo) Finish(ctx context.Context, id, owner string, status models.JobStatus, resultPath, errMsg string) (bool, error) {
+	if !models.JobRunning.CanTransitionTo(status) || !status.IsTerminal() {
+		return false, fmt.Errorf("%w: job %s cannot finish as %s", ErrInvalidTransition, id, status)
+	}
+	res := r.db.WithContext(ctx).Model(&jobRecord{}).
+		Where("id = ? AND owner = ? AND status = 'RUNNING'", id, owner).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"result_path": resultPath,
+			"error":       errMsg,
+			"lease_until": nil,
+			"updated_at":  time.Now(),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// interrupted releases the lease and gives back the attempt, so jobs cut
+// short by deploys are not failed as abandoned.
+func interrupted() map[string]interface{} {
+	return map[string]interface{}{
+		"status":      "INTERRUPTED",
+		"lease_until": nil,
+		"attempts":    gorm.Expr("GREATEST(attempts - 1, 0)"),
+		"updated_at":  time.Now(),
+	}
+}
+
+func (r *jobRepo) Interrupt(ctx context.Context, id, owner string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&jobRecord{}).
+		Where("id = ? AND owner = ? AND status = 'RUNNING'", id, owner).
+		Updates(interrupted())
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *jobRepo) Retry(ctx context.Context, id, owner string, retryAt time.Time, errMsg string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&jobRecord{}).
+		Where("id = ? AND owner = ? AND status = 'RUNNING'", id, owner).
+		Updates(map[string]interface{}{
+			"status":      "INTERRUPTED",
+			"lease_until": retryAt,
+			"error":       errMsg,
+			"updated_at":  time.Now(),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *jobRepo) CountQueued(ctx context.Context, queue string) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&jobRecord{}).
+		Where("status = 'QUEUED' AND queue = ?", queue).
+		Count(&n).Error
+	return n, err
+}
+
+func (r *jobRepo) QueuedByTenant(ctx context.Context) ([]QueuedCount, error) {
+	var out []QueuedCount
+	err := r.db.WithContext(ctx).Model(&jobRecord{}).
+		Select("queue, tenant, COUNT(*) AS count").
+		Where("status = 'QUEUED'").
+		Group("queue, tenant").
+		Scan(&out).Error
+	return out, err
 }
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"indico-be/internal/models"
+)
+
+// fakeJobRow is a single job_records row. It understands the UPDATEs
+// and the lookup by id the job repository sends, evaluating their WHERE
+// the way MySQL would, so refusals come from the same conditions.
+type fakeJobRow struct {
+	id, status, owner string
+}
+
+var (
+	setColumn = regexp.MustCompile("`(\\w+)`=\\?")
+	condition = regexp.MustCompile(`^\(?(\w+) (= \?|= '(\w+)'|IN \(([?,]+)\))\)?$`)
+)
+
+func (j *fakeJobRow) answer(q string, args []driver.Value) (fakeResult, error) {
+	switch {
+	case strings.HasPrefix(q, "SELECT * FROM `job_records`"):
+		if args[0] != j.id {
+			return fakeResult{Columns: []string{"id", "status", "owner"}}, nil
+		}
+		return fakeResult{
+			Columns: []string{"id", "status", "owner"},
+			Rows:    [][]driver.Value{{j.id, j.status, j.owner}},
+		}, nil
+
+	case strings.HasPrefix(q, "UPDATE `job_records` SET"):
+		set, where, _ := strings.Cut(strings.TrimPrefix(q, "UPDATE `job_records` SET "), " WHERE ")
+		cols := setColumn.FindAllStringSubmatch(set, -1)
+		values, rest := args[:len(cols)], args[len(cols):]
+
+		for _, cond := range strings.Split(where, " AND ") {
+			m := condition.FindStringSubmatch(strings.TrimSpace(cond))
+			if m == nil {
+				return fakeResult{}, fmt.Errorf("fake job_records: unsupported condition %q", cond)
+			}
+			current := map[string]string{"id": j.id, "status": j.status, "owner": j.owner}[m[1]]
+			switch {
+			case m[2] == "= ?":
+				if rest[0] != current {
+					return fakeResult{}, nil
+				}
+				rest = rest[1:]
+			case m[3] != "":
+				if m[3] != current {
+					return fakeResult{}, nil
+				}
+			default:
+				n := strings.Count(m[4], "?")
+				match := false
+				for _, v := range rest[:n] {
+					match = match || v == current
+				}
+				if !match {
+					return fakeResult{}, nil
+				}
+				rest = rest[n:]
+			}
+		}
+		for i, c := range cols {
+			if c[1] == "status" {
+				j.status = fmt.Sprint(values[i])
+			}
+		}
+		return fakeResult{Affected: 1}, nil
+	}
+	return fakeResult{}, fmt.Errorf("fake job_records: unexpected statement %s", q)
+}
+
+func newFakeJobRepo(t *testing.T, status models.JobStatus) (JobRepository, *fakeJobRow) {
+	row := &fakeJobRow{id: "job-1", status: string(status), owner: "instance-a"}
+	db, _ := newFakeDB(t, row.answer)
+	return NewJobRepository(db), row
+}
+
+func TestJobFinishAfterCancelIsRefused(t *testing.T) {
+	repo, row := newFakeJobRepo(t, models.JobRunning)
+	ctx := context.Background()
+
+	if err := repo.MarkCancelled(ctx, "job-1"); err != nil {
+		t.Fatalf("cancel running job: %v", err)
+	}
+	won, err := repo.Finish(ctx, "job-1", "instance-a", models.JobFinished, "/public/downloads/job-1.csv", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if won {
+		t.Fatal("Finish overwrote a cancelled job")
+	}
+	if row.status != string(models.JobCanceled) {
+		t.Errorf("status = %s, want CANCELED", row.status)
+	}
+
+	// Finishing as a non-terminal status is refused before touching the row.
+	if _, err := repo.Finish(ctx, "job-1", "instance-a", models.JobInterrupted, "", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Finish as INTERRUPTED: err = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestJobRunningAfterFinishIsRefused(t *testing.T) {
+	repo, row := newFakeJobRepo(t, models.JobFinished)
+	ctx := context.Background()
+
+	err := repo.UpdateStatus(ctx, "job-1", models.JobRunning)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("err = %v, want ErrInvalidTransition", err)
+	}
+	if !strings.Contains(err.Error(), "job job-1 is FINISHED, cannot become RUNNING") {
+		t.Errorf("err = %v, want it to name both statuses", err)
+	}
+	if err := repo.MarkCancelled(ctx, "job-1"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("cancel finished job: err = %v, want ErrInvalidTransition", err)
+	}
+	if row.status != string(models.JobFinished) {
+		t.Errorf("status = %s, want FINISHED", row.status)
+	}
+}
+
+func TestJobAllowedTransitionsApply(t *testing.T) {
+	repo, row := newFakeJobRepo(t, models.JobQueued)
+	ctx := context.Background()
+
+	if err := repo.UpdateStatus(ctx, "job-1", models.JobRunning); err != nil {
+		t.Fatal(err)
+	}
+	won, err := repo.Finish(ctx, "job-1", "instance-a", models.JobFinishedWithWarnings, "", "")
+	if err != nil || !won {
+		t.Fatalf("Finish = %v, %v; want true", won, err)
+	}
+	if row.status != string(models.JobFinishedWithWarnings) {
+		t.Errorf("status = %s, want FINISHED_WITH_WARNINGS", row.status)
+	}
+}
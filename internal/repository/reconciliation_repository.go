@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+
+	"indico-be/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type Reconciliation struct {
+	models.Reconciliation
+}
+
+type ReconciliationRepository interface {
+	ReplaceForJob(ctx context.Context, jobID string, rows []models.Reconciliation) error
+	ListByJob(ctx context.Context, jobID string) ([]models.Reconciliation, error)
+}
+
+type reconciliationRepo struct {
+	db *gorm.DB
+}
+
+func NewReconciliationRepo(db *gorm.DB) ReconciliationRepository {
+	return &reconciliationRepo{db: db}
+}
+
+// ReplaceForJob drops the previous result of a job before storing the new
+// one, so re-running reconciliation never duplicates discrepancies.
+func (r *reconciliationRepo) ReplaceForJob(ctx context.Context, jobID string, rows []models.Reconciliation) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("job_id = ?", jobID).Delete(&models.Reconciliation{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 500).Error
+	})
+}
+
+func (r *reconciliationRepo) ListByJob(ctx context.Context, jobID string) ([]models.Reconciliation, error) {
+	var rows []models.Reconciliation
+	err := r.db.WithContext(ctx).
+		Where("job_id = ?", jobID).
+		Order("merchant_id, date").
+		Find(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,463 @@
+// Package repotest provides in-memory repositories for tests of the
+// services and job runners built on top of them. Each one embeds its
+// interface: a method a test does not expect panics.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// ErrInjected is what Transactions returns for the batch it is told to fail.
+var ErrInjected = errors.New("connection reset")
+
+// Transactions serves Txs in (paid_at, id) order, as if all were paid. Call
+// number FailAt of GetBatchAfter fails with ErrInjected, and OnBatch runs
+// before every other one.
+type Transactions struct {
+	repository.TransactionRepository
+
+	Txs     []repository.Transaction
+	FailAt  int
+	OnBatch func(call int)
+
+	mu     sync.Mutex
+	calls  int
+	read   int
+	afters []repository.Cursor
+}
+
+func inPeriod(tx repository.Transaction, from, to time.Time, after repository.Cursor) bool {
+	c := repository.Cursor{PaidAt: tx.PaidAt, ID: tx.ID}
+	return !tx.PaidAt.Before(from) && !tx.PaidAt.After(to) && c.After(after)
+}
+
+func (r *Transactions) CountAfter(_ context.Context, from, to time.Time, after repository.Cursor) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, tx := range r.Txs {
+		if inPeriod(tx, from, to, after) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *Transactions) GetBatchAfter(_ context.Context, from, to time.Time, after repository.Cursor, limit int) ([]repository.Transaction, error) {
+	r.mu.Lock()
+	r.calls++
+	call := r.calls
+	r.mu.Unlock()
+	if call == r.FailAt {
+		return nil, ErrInjected
+	}
+	if r.OnBatch != nil {
+		r.OnBatch(call)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.afters = append(r.afters, after)
+	var out []repository.Transaction
+	for _, tx := range r.Txs {
+		if len(out) < limit && inPeriod(tx, from, to, after) {
+			out = append(out, tx)
+		}
+	}
+	r.read += len(out)
+	return out, nil
+}
+
+// DailyTotals reports nothing, so reconciliation finds nothing to compare.
+func (r *Transactions) DailyTotals(context.Context, time.Time, time.Time) ([]models.DailyTotal, error) {
+	return nil, nil
+}
+
+// Read is how many transactions GetBatchAfter returned since the last
+// Reset, and the cursors it was called with.
+func (r *Transactions) Read() (int, []repository.Cursor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.read, append([]repository.Cursor(nil), r.afters...)
+}
+
+// Reset starts counting calls, reads and cursors afresh, so FailAt
+// counts from the next call.
+func (r *Transactions) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls, r.read, r.afters = 0, 0, nil
+}
+
+// Settlements keeps every written version, which of them are current, the
+// periods promoted, the watermarks, the checkpoints by job and how many
+// were saved at each stage. InTx does not roll back.
+type Settlements struct {
+	repository.SettlementRepository
+
+	mu          sync.Mutex
+	written     []models.Settlement
+	current     map[string]models.Settlement
+	promoted    [][2]time.Time
+	watermarks  map[string]models.SettlementWatermark
+	checkpoints map[string]models.SettlementCheckpoint
+	saves       map[string]int
+}
+
+func NewSettlements() *Settlements {
+	return &Settlements{
+		current:     make(map[string]models.Settlement),
+		watermarks:  make(map[string]models.SettlementWatermark),
+		checkpoints: make(map[string]models.SettlementCheckpoint),
+		saves:       make(map[string]int),
+	}
+}
+
+func settlementKey(s models.Settlement) string {
+	return fmt.Sprintf("%d|%s|%s", s.MerchantID, s.Date.Format("2006-01-02"), s.Currency)
+}
+
+func (r *Settlements) InTx(_ context.Context, fn func(repo repository.SettlementRepository) error) error {
+	return fn(r)
+}
+
+func (r *Settlements) SaveVersions(_ context.Context, rows []*models.Settlement, _ int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range rows {
+		r.written = append(r.written, *s)
+	}
+	return nil
+}
+
+func (r *Settlements) PromoteRun(_ context.Context, runID string, from, to time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.promoted = append(r.promoted, [2]time.Time{from, to})
+	for k, s := range r.current {
+		if !s.Date.Before(from) && !s.Date.After(to) {
+			delete(r.current, k)
+		}
+	}
+	for _, s := range r.written {
+		if s.RunID == runID && !s.Date.Before(from) && !s.Date.After(to) {
+			r.current[settlementKey(s)] = s
+		}
+	}
+	return nil
+}
+
+func (r *Settlements) PromoteRunKeys(_ context.Context, runID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.written {
+		if s.RunID == runID {
+			r.current[settlementKey(s)] = s
+		}
+	}
+	return nil
+}
+
+func (r *Settlements) ListCurrent(_ context.Context, merchantID uint64, from, to time.Time) ([]models.Settlement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []models.Settlement
+	for _, s := range r.current {
+		if (merchantID == 0 || s.MerchantID == merchantID) && !s.Date.Before(from) && !s.Date.After(to) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (r *Settlements) GetWatermark(_ context.Context, stream string) (*models.SettlementWatermark, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wm, ok := r.watermarks[stream]
+	if !ok {
+		return nil, nil
+	}
+	return &wm, nil
+}
+
+// LockWatermark locks nothing; tests interleave runs by hand.
+func (r *Settlements) LockWatermark(ctx context.Context, stream string) (*models.SettlementWatermark, error) {
+	return r.GetWatermark(ctx, stream)
+}
+
+func (r *Settlements) AdvanceWatermark(_ context.Context, stream string, to repository.Cursor, runID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if wm, ok := r.watermarks[stream]; ok && !to.After(repository.Cursor{PaidAt: wm.LastPaidAt, ID: wm.LastTxnID}) {
+		return nil
+	}
+	r.watermarks[stream] = models.SettlementWatermark{Stream: stream, LastPaidAt: to.PaidAt, LastTxnID: to.ID, RunID: runID, UpdatedAt: time.Now()}
+	return nil
+}
+
+func (r *Settlements) ListSpans(context.Context, string) ([]models.SettlementSpan, error) {
+	return nil, nil
+}
+
+func (r *Settlements) DailyTotals(context.Context, time.Time, time.Time) ([]models.DailyTotal, error) {
+	return nil, nil
+}
+
+func (r *Settlements) ListByRun(_ context.Context, runID string) ([]models.Settlement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []models.Settlement
+	for _, s := range r.written {
+		if s.RunID == runID {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (r *Settlements) GetCheckpoint(_ context.Context, jobID string) (*models.SettlementCheckpoint, error) {
+	cp, ok := r.Checkpoint(jobID)
+	if !ok {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+func (r *Settlements) SaveCheckpoint(_ context.Context, cp *models.SettlementCheckpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkpoints[cp.JobID] = *cp
+	r.saves[cp.Stage]++
+	return nil
+}
+
+func (r *Settlements) DeleteCheckpoint(_ context.Context, jobID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checkpoints, jobID)
+	return nil
+}
+
+// Written returns every settlement version saved so far.
+func (r *Settlements) Written() []models.Settlement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.Settlement(nil), r.written...)
+}
+
+// Promoted returns the [from, to] of every PromoteRun.
+func (r *Settlements) Promoted() [][2]time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][2]time.Time(nil), r.promoted...)
+}
+
+func (r *Settlements) Checkpoint(jobID string) (models.SettlementCheckpoint, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp, ok := r.checkpoints[jobID]
+	return cp, ok
+}
+
+// Saves is how many checkpoints were saved at stage.
+func (r *Settlements) Saves(stage string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.saves[stage]
+}
+
+// Reconciliations stores nothing.
+type Reconciliations struct {
+	repository.ReconciliationRepository
+}
+
+func (Reconciliations) ReplaceForJob(context.Context, string, []models.Reconciliation) error {
+	return nil
+}
+
+// Jobs holds job records and applies claims, leases and status changes
+// the way the job_records queries do.
+type Jobs struct {
+	repository.JobRepository
+
+	mu   sync.Mutex
+	jobs map[string]*models.Job
+}
+
+func NewJobs(jobs ...models.Job) *Jobs {
+	r := &Jobs{jobs: make(map[string]*models.Job)}
+	for i := range jobs {
+		j := jobs[i]
+		r.jobs[j.ID] = &j
+	}
+	return r
+}
+
+// Put adds or replaces a job record.
+func (r *Jobs) Put(j models.Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[j.ID] = &j
+}
+
+func (r *Jobs) SetStatus(id string, status models.JobStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[id].Status = status
+}
+
+func (r *Jobs) GetByID(_ context.Context, id string) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	c := *j
+	return &c, nil
+}
+
+func (r *Jobs) MarkCancelled(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.jobs[id]
+	if !j.Status.CanTransitionTo(models.JobCanceled) {
+		return repository.ErrInvalidTransition
+	}
+	j.Status = models.JobCanceled
+	return nil
+}
+
+func (r *Jobs) UpdateTotal(_ context.Context, id string, total int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[id].Total = total
+	return nil
+}
+
+func (r *Jobs) UpdateProgress(_ context.Context, id string, p repository.Progress) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.jobs[id]
+	j.Processed, j.Phase = p.Processed, p.Phase
+	if p.Progress > j.Progress {
+		j.Progress = p.Progress
+	}
+	return nil
+}
+
+func claimable(j *models.Job, now time.Time) bool {
+	switch j.Status {
+	case models.JobQueued:
+		return true
+	case models.JobInterrupted, models.JobRunning:
+		return j.LeaseUntil == nil || j.LeaseUntil.Before(now)
+	}
+	return false
+}
+
+func (r *Jobs) ListClaimable(_ context.Context, now time.Time) ([]models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []models.Job
+	for _, j := range r.jobs {
+		if claimable(j, now) {
+			out = append(out, *j)
+		}
+	}
+	return out, nil
+}
+
+func (r *Jobs) Claim(_ context.Context, id, owner string, now, leaseUntil time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.jobs[id]
+	if !claimable(j, now) {
+		return false, nil
+	}
+	j.Status, j.Owner, j.LeaseUntil = models.JobRunning, owner, &leaseUntil
+	j.Attempts++
+	return true, nil
+}
+
+// held returns the job if owner still runs it.
+func (r *Jobs) held(id, owner string) *models.Job {
+	j := r.jobs[id]
+	if j.Owner != owner || j.Status != models.JobRunning {
+		return nil
+	}
+	return j
+}
+
+func (r *Jobs) Heartbeat(_ context.Context, id, owner string, leaseUntil time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.held(id, owner)
+	if j == nil {
+		return false, nil
+	}
+	j.LeaseUntil = &leaseUntil
+	return true, nil
+}
+
+func (r *Jobs) Finish(_ context.Context, id, owner string, status models.JobStatus, resultPath, errMsg string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.held(id, owner)
+	if j == nil {
+		return false, nil
+	}
+	j.Status, j.ResultPath, j.Error, j.LeaseUntil = status, resultPath, errMsg, nil
+	return true, nil
+}
+
+func (r *Jobs) Interrupt(_ context.Context, id, owner string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.held(id, owner)
+	if j == nil {
+		return false, nil
+	}
+	j.Status, j.LeaseUntil = models.JobInterrupted, nil
+	if j.Attempts > 0 {
+		j.Attempts--
+	}
+	return true, nil
+}
+
+func (r *Jobs) Retry(_ context.Context, id, owner string, retryAt time.Time, errMsg string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.held(id, owner)
+	if j == nil {
+		return false, nil
+	}
+	j.Status, j.LeaseUntil, j.Error = models.JobInterrupted, &retryAt, errMsg
+	return true, nil
+}
+
+// SettlementFixture is 30 transactions of two merchants over 1–3 January 2025.
+func SettlementFixture() []repository.Transaction {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var txs []repository.Transaction
+	for i := 1; i <= 30; i++ {
+		txs = append(txs, repository.Transaction{Transaction: models.Transaction{
+			ID:          uint64(i),
+			MerchantID:  uint64(1 + i%2),
+			Currency:    "IDR",
+			AmountCents: int64(1000 * i),
+			FeeCents:    int64(10 * i),
+			PaidAt:      day.Add(time.Duration(i) * 2 * time.Hour),
+		}})
+	}
+	return txs
+}
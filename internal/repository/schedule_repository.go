@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"indico-be/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type Schedule struct {
+	models.Schedule
+}
+
+type ScheduleRepository interface {
+	Create(ctx context.Context, s *models.Schedule) error
+	Update(ctx context.Context, s *models.Schedule) error
+	Delete(ctx context.Context, id uint64) error
+	GetByID(ctx context.Context, id uint64) (*models.Schedule, error)
+	List(ctx context.Context) ([]models.Schedule, error)
+	ListDue(ctx context.Context, now time.Time) ([]models.Schedule, error)
+	ClaimTick(ctx context.Context, id uint64, tick, next time.Time, job *models.Job) (bool, error)
+}
+
+type scheduleRepo struct {
+	db *gorm.DB
+}
+
+func NewScheduleRepo(db *gorm.DB) ScheduleRepository {
+	return &scheduleRepo{db: db}
+}
+
+func (r *scheduleRepo) Create(ctx context.Context, s *models.Schedule) error {
+	return r.db.WithContext(ctx).Create(s).Error
+}
+
+func (r *scheduleRepo) Update(ctx context.Context, s *models.Schedule) error {
+	return r.db.WithContext(ctx).Save(s).Error
+}
+
+func (r *scheduleRepo) Delete(ctx context.Context, id uint64) error {
+	res := r.db.WithContext(ctx).Delete(&models.Schedule{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *scheduleRepo) GetByID(ctx context.Context, id uint64) (*models.Schedule, error) {
+	var s models.Schedule
+	if err := r.db.WithContext(ctx).First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *scheduleRepo) List(ctx context.Context) ([]models.Schedule, error) {
+	var rows []models.Schedule
+	err := r.db.WithContext(ctx).Order("id").Find(&rows).Error
+	return rows, err
+}
+
+func (r *scheduleRepo) ListDue(ctx context.Context, now time.Time) ([]models.Schedule, error) {
+	var rows []models.Schedule
+	err := r.db.WithContext(ctx).
+		Where("enabled = ? AND next_run_at <= ?", true, now).
+		Order("next_run_at").
+		Find(&rows).Error
+	return rows, err
+}
+
+// ClaimTick moves a schedule from tick to next and inserts the tick's job in
+// the same transaction, so a tick is never taken without its job. The update
+// only matches while next_run_at still equals tick, so when several
+// replicas see the same due schedule exactly one of them wins the tick and
+// enqueues the job.
+func (r *scheduleRepo) ClaimTick(ctx context.Context, id uint64, tick, next time.Time, job *models.Job) (bool, error) {
+	won := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.Schedule{}).
+			Where("id = ? AND next_run_at = ?", id, tick).
+			Updates(map[string]interface{}{
+				"next_run_at": next,
+				"last_run_at": now,
+				"last_job_id": job.ID,
+				"updated_at":  now,
+			})
+		if res.Error != nil || res.RowsAffected != 1 {
+			return res.Error
+		}
+		won = true
+		return (&jobRepo{db: tx}).Create(ctx, job)
+	})
+	if err != nil {
+		return false, err
+	}
+	return won, nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"indico-be/internal/models"
+)
+
+// TestClaimTickStoresJob checks that a tick is only ever advanced together
+// with the insert of its job.
+func TestClaimTickStoresJob(t *testing.T) {
+	tick := time.Date(2025, 1, 2, 1, 0, 0, 0, time.UTC)
+	next := tick.AddDate(0, 0, 1)
+	insertFailed := errors.New("insert failed")
+
+	for _, tc := range []struct {
+		name     string
+		claimed  int64 // rows the schedule update matches
+		insert   error
+		wantWon  bool
+		wantErr  error
+		wantStmt string
+	}{
+		{"won", 1, nil, true, nil, "BEGIN CLAIM INSERT COMMIT"},
+		{"taken by another replica", 0, nil, false, nil, "BEGIN CLAIM COMMIT"},
+		{"job insert fails", 1, insertFailed, false, insertFailed, "BEGIN CLAIM INSERT ROLLBACK"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, func(q string, args []driver.Value) (fakeResult, error) {
+				if strings.Contains(q, "INSERT INTO job_records") {
+					return fakeResult{Affected: 1}, tc.insert
+				}
+				return fakeResult{Affected: tc.claimed}, nil
+			})
+			repo := NewScheduleRepo(db)
+			job := &models.Job{ID: "job-1", Type: "settlement", Status: models.JobQueued}
+
+			won, err := repo.ClaimTick(context.Background(), 7, tick, next, job)
+			if won != tc.wantWon || !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ClaimTick = %v, %v; want %v, %v", won, err, tc.wantWon, tc.wantErr)
+			}
+
+			var got []string
+			for _, s := range fake.statements("") {
+				switch {
+				case s.Tx != "":
+					got = append(got, s.Tx)
+				case strings.HasPrefix(s.Query, "UPDATE `schedules`"):
+					got = append(got, "CLAIM")
+					if !strings.Contains(s.Query, "`last_job_id`=?") {
+						t.Errorf("claim does not record the job: %s", s.Query)
+					}
+				case strings.Contains(s.Query, "INSERT INTO job_records"):
+					got = append(got, "INSERT")
+				}
+			}
+			if strings.Join(got, " ") != tc.wantStmt {
+				t.Errorf("statements = %v, want %s", got, tc.wantStmt)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"indico-be/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// benchRows is how many settlements one benchmark iteration writes.
+const benchRows = 10_000
+
+// benchDB opens the database named by BENCH_MYSQL_DSN (a go-sql-driver DSN
+// with parseTime=true) and deletes the bench-* settlements once b ends.
+// Without it the benchmark is skipped.
+func benchDB(b *testing.B) *gorm.DB {
+	dsn := os.Getenv("BENCH_MYSQL_DSN")
+	if dsn == "" {
+		b.Skip("BENCH_MYSQL_DSN not set")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		if err := db.Exec("DELETE FROM settlements WHERE run_id LIKE 'bench-%'").Error; err != nil {
+			b.Errorf("deleting bench settlements: %v", err)
+		}
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// benchSettlements builds n aggregates of one fresh run: 100 merchants over
+// as many days as needed, in 1990 so they never touch real settlements.
+func benchSettlements(n int) []*models.Settlement {
+	runID := "bench-" + uuid.NewString()
+	start := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := make([]*models.Settlement, n)
+	for i := range out {
+		gross := int64(100_000 + i)
+		out[i] = &models.Settlement{
+			MerchantID:  uint64(i%100 + 1),
+			Date:        start.AddDate(0, 0, i/100),
+			Currency:    "IDR",
+			GrossCents:  gross,
+			FeeCents:    gross / 100,
+			NetCents:    gross - gross/100,
+			TxnCount:    10,
+			GeneratedAt: time.Now(),
+			RunID:       runID,
+		}
+	}
+	return out
+}
+
+// benchWrite times write on a fresh run of benchRows settlements per
+// iteration and reports the throughput.
+func benchWrite(b *testing.B, repo SettlementRepository, write func(tx SettlementRepository, rows []*models.Settlement) error) {
+	ctx := context.Background()
+	b.StopTimer()
+	for i := 0; i < b.N; i++ {
+		rows := benchSettlements(benchRows)
+		b.StartTimer()
+		err := repo.InTx(ctx, func(tx SettlementRepository) error { return write(tx, rows) })
+		b.StopTimer()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(benchRows*b.N)/b.Elapsed().Seconds(), "rows/s")
+}
+
+// BenchmarkSaveVersion writes settlements one statement per row, the
+// baseline for BenchmarkSaveVersions.
+func BenchmarkSaveVersion(b *testing.B) {
+	repo := NewSettlementRepo(benchDB(b))
+	benchWrite(b, repo, func(tx SettlementRepository, rows []*models.Settlement) error {
+		for _, s := range rows {
+			if err := tx.SaveVersion(context.Background(), s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func BenchmarkSaveVersions(b *testing.B) {
+	repo := NewSettlementRepo(benchDB(b))
+	for _, chunk := range []int{100, 500, 1000} {
+		b.Run(fmt.Sprintf("chunk=%d", chunk), func(b *testing.B) {
+			benchWrite(b, repo, func(tx SettlementRepository, rows []*models.Settlement) error {
+				return tx.SaveVersions(context.Background(), rows, chunk)
+			})
+		})
+	}
+}
@@ -2,6 +2,10 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"indico-be/internal/models"
 
@@ -13,8 +17,36 @@ type Settlement struct {
 	models.Settlement
 }
 
+type SettlementWatermark struct {
+	models.SettlementWatermark
+}
+
+type SettlementCheckpoint struct {
+	models.SettlementCheckpoint
+}
+
 type SettlementRepository interface {
-	Upsert(ctx context.Context, s *models.Settlement) error
+	InTx(ctx context.Context, fn func(repo SettlementRepository) error) error
+	SaveVersion(ctx context.Context, s *models.Settlement) error
+	SaveVersions(ctx context.Context, rows []*models.Settlement, chunkSize int) error
+	PromoteRun(ctx context.Context, runID string, from, to time.Time) error
+	PromoteRunKeys(ctx context.Context, runID string) error
+	GetWatermark(ctx context.Context, stream string) (*models.SettlementWatermark, error)
+	ListWatermarks(ctx context.Context) ([]models.SettlementWatermark, error)
+	// LockWatermark returns the stream's watermark, or nil, and holds it
+	// until the transaction of InTx ends.
+	LockWatermark(ctx context.Context, stream string) (*models.SettlementWatermark, error)
+	AdvanceWatermark(ctx context.Context, stream string, to Cursor, runID string) error
+	AddSpan(ctx context.Context, span *models.SettlementSpan) error
+	ListSpans(ctx context.Context, stream string) ([]models.SettlementSpan, error)
+	DeleteSpan(ctx context.Context, id uint64) error
+	DailyTotals(ctx context.Context, from, to time.Time) ([]models.DailyTotal, error)
+	ListByRun(ctx context.Context, runID string) ([]models.Settlement, error)
+	ListCurrent(ctx context.Context, merchantID uint64, from, to time.Time) ([]models.Settlement, error)
+	ListVersions(ctx context.Context, merchantID uint64, date time.Time) ([]models.Settlement, error)
+	GetCheckpoint(ctx context.Context, jobID string) (*models.SettlementCheckpoint, error)
+	SaveCheckpoint(ctx context.Context, cp *models.SettlementCheckpoint) error
+	DeleteCheckpoint(ctx context.Context, jobID string) error
 }
 
 type settlementRepo struct {
@@ -25,9 +57,272 @@ func NewSettlementRepo(db *gorm.DB) SettlementRepository {
 	return &settlementRepo{db: db}
 }
 
-func (r *settlementRepo) Upsert(ctx context.Context, s *models.Settlement) error {
-	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "merchant_id"}, {Name: "date"}},
-		DoUpdates: clause.AssignmentColumns([]string{"gross_cents", "fee_cents", "net_cents", "txn_count"}),
-	}).Create(s).Error
+// InTx runs fn with a repository bound to a single database transaction.
+func (r *settlementRepo) InTx(ctx context.Context, fn func(repo SettlementRepository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&settlementRepo{db: tx})
+	})
+}
+
+// SaveVersion writes the run's version of a merchant/day/currency. The version number
+// continues from the latest existing one; writing the same run twice only
+// refreshes its numbers so retries never create extra versions.
+func (r *settlementRepo) SaveVersion(ctx context.Context, s *models.Settlement) error {
+	return r.InTx(ctx, func(repo SettlementRepository) error {
+		return repo.(*settlementRepo).saveChunk(ctx, []*models.Settlement{s})
+	})
+}
+
+// SaveVersions is SaveVersion for many rows: one multi-row statement per
+// chunk of chunkSize rows. It does not open a transaction of its own; run it
+// under InTx so a failed chunk leaves nothing behind.
+func (r *settlementRepo) SaveVersions(ctx context.Context, rows []*models.Settlement, chunkSize int) error {
+	if chunkSize <= 0 {
+		chunkSize = len(rows)
+	}
+	for start := 0; start < len(rows); start += chunkSize {
+		end := start + chunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := r.saveChunk(ctx, rows[start:end]); err != nil {
+			return fmt.Errorf("gagal menyimpan settlement %d-%d: %w", start, end, err)
+		}
+	}
+	return nil
+}
+
+// saveChunk numbers each row after the latest version of its key. Two runs
+// writing the same key at once would read the same MAX(version), so the
+// keys are locked first: the second run waits for the first to commit and
+// numbers after it. uk_merchant_date_version backs this up for any other
+// writer.
+func (r *settlementRepo) saveChunk(ctx context.Context, rows []*models.Settlement) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := r.lockKeys(ctx, rows); err != nil {
+		return err
+	}
+
+	values := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*14)
+	for i, s := range rows {
+		values[i] = "SELECT ? AS merchant_id, ? AS date, ? AS currency, ? AS gross_cents, ? AS fee_cents, ? AS net_cents, ? AS txn_count, " +
+			"? AS settlement_currency, ? AS fx_rate, ? AS settled_gross_cents, ? AS settled_fee_cents, ? AS settled_net_cents, " +
+			"? AS generated_at, ? AS run_id"
+		args = append(args, s.MerchantID, s.Date, s.Currency, s.GrossCents, s.FeeCents, s.NetCents, s.TxnCount,
+			s.SettlementCurrency, s.FxRate, s.SettledGrossCents, s.SettledFeeCents, s.SettledNetCents,
+			s.GeneratedAt, s.RunID)
+	}
+
+	return r.db.WithContext(ctx).Exec(`
+		INSERT INTO settlements (
+			merchant_id, date, currency, gross_cents, fee_cents, net_cents, txn_count,
+			settlement_currency, fx_rate, settled_gross_cents, settled_fee_cents, settled_net_cents,
+			generated_at, run_id, version, is_current
+		)
+		SELECT v.merchant_id, v.date, v.currency, v.gross_cents, v.fee_cents, v.net_cents, v.txn_count,
+			v.settlement_currency, v.fx_rate, v.settled_gross_cents, v.settled_fee_cents, v.settled_net_cents,
+			v.generated_at, v.run_id,
+			(SELECT COALESCE(MAX(s.version), 0) + 1 FROM settlements s
+			 WHERE s.merchant_id = v.merchant_id AND s.date = v.date AND s.currency = v.currency),
+			FALSE
+		FROM (`+strings.Join(values, " UNION ALL ")+`) v
+		ON DUPLICATE KEY UPDATE
+			gross_cents = VALUES(gross_cents),
+			fee_cents = VALUES(fee_cents),
+			net_cents = VALUES(net_cents),
+			txn_count = VALUES(txn_count),
+			settlement_currency = VALUES(settlement_currency),
+			fx_rate = VALUES(fx_rate),
+			settled_gross_cents = VALUES(settled_gross_cents),
+			settled_fee_cents = VALUES(settled_fee_cents),
+			settled_net_cents = VALUES(settled_net_cents),
+			generated_at = VALUES(generated_at)
+	`, args...).Error
+}
+
+// lockKeys locks the existing versions of the rows' merchant/day/currency,
+// and under REPEATABLE READ the gap where a new one would go, until the
+// surrounding transaction ends.
+func (r *settlementRepo) lockKeys(ctx context.Context, rows []*models.Settlement) error {
+	keys := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*3)
+	for i, s := range rows {
+		keys[i] = "(?, ?, ?)"
+		args = append(args, s.MerchantID, s.Date, s.Currency)
+	}
+	var ids []int64
+	return r.db.WithContext(ctx).Raw(`
+		SELECT id FROM settlements
+		WHERE (merchant_id, date, currency) IN (`+strings.Join(keys, ", ")+`)
+		FOR UPDATE
+	`, args...).Scan(&ids).Error
+}
+
+// PromoteRun makes the run's versions current for [from, to]; every other
+// version in the period stays queryable but is no longer current.
+func (r *settlementRepo) PromoteRun(ctx context.Context, runID string, from, to time.Time) error {
+	return r.db.WithContext(ctx).Exec(`
+		UPDATE settlements
+		SET is_current = (run_id = ?)
+		WHERE date >= ? AND date <= ?
+	`, runID, from, to).Error
+}
+
+// PromoteRunKeys makes the run's versions current only for the
+// merchant/day/currencies the run wrote; other rows keep their current
+// version. Incremental runs use this since they only touch some days.
+func (r *settlementRepo) PromoteRunKeys(ctx context.Context, runID string) error {
+	return r.db.WithContext(ctx).Exec(`
+		UPDATE settlements s
+		JOIN settlements r
+			ON r.merchant_id = s.merchant_id AND r.date = s.date AND r.currency = s.currency AND r.run_id = ?
+		SET s.is_current = (s.run_id = ?)
+	`, runID, runID).Error
+}
+
+// GetWatermark returns nil when the stream has never been processed.
+func (r *settlementRepo) GetWatermark(ctx context.Context, stream string) (*models.SettlementWatermark, error) {
+	var wm models.SettlementWatermark
+	err := r.db.WithContext(ctx).Where("stream = ?", stream).First(&wm).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wm, nil
+}
+
+// LockWatermark reads the row FOR UPDATE. A stream without a watermark
+// gets a gap lock instead, so the first runs of a new stream can deadlock;
+// MySQL then fails one of them.
+func (r *settlementRepo) LockWatermark(ctx context.Context, stream string) (*models.SettlementWatermark, error) {
+	var wm models.SettlementWatermark
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("stream = ?", stream).First(&wm).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wm, nil
+}
+
+func (r *settlementRepo) ListWatermarks(ctx context.Context) ([]models.SettlementWatermark, error) {
+	var rows []models.SettlementWatermark
+	err := r.db.WithContext(ctx).Order("stream").Find(&rows).Error
+	return rows, err
+}
+
+// AdvanceWatermark moves the stream's mark to `to`; it never moves it back.
+func (r *settlementRepo) AdvanceWatermark(ctx context.Context, stream string, to Cursor, runID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var wm models.SettlementWatermark
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("stream = ?", stream).First(&wm).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && !to.After(Cursor{PaidAt: wm.LastPaidAt, ID: wm.LastTxnID}) {
+			return nil
+		}
+		return tx.Save(&models.SettlementWatermark{
+			Stream:     stream,
+			LastPaidAt: to.PaidAt,
+			LastTxnID:  to.ID,
+			RunID:      runID,
+			UpdatedAt:  time.Now(),
+		}).Error
+	})
+}
+
+func (r *settlementRepo) AddSpan(ctx context.Context, span *models.SettlementSpan) error {
+	return r.db.WithContext(ctx).Create(span).Error
+}
+
+// ListSpans returns the stream's spans in the order the watermark meets them.
+func (r *settlementRepo) ListSpans(ctx context.Context, stream string) ([]models.SettlementSpan, error) {
+	var rows []models.SettlementSpan
+	err := r.db.WithContext(ctx).Where("stream = ?", stream).Order("from_paid_at, id").Find(&rows).Error
+	return rows, err
+}
+
+func (r *settlementRepo) DeleteSpan(ctx context.Context, id uint64) error {
+	return r.db.WithContext(ctx).Delete(&models.SettlementSpan{}, id).Error
+}
+
+// DailyTotals sums the current versions of [from, to].
+func (r *settlementRepo) DailyTotals(ctx context.Context, from, to time.Time) ([]models.DailyTotal, error) {
+	var totals []models.DailyTotal
+
+	err := r.db.WithContext(ctx).
+		Model(&Settlement{}).
+		Select("merchant_id, DATE(date) AS date, currency, SUM(txn_count) AS txn_count, SUM(gross_cents) AS gross_cents, SUM(fee_cents) AS fee_cents").
+		Where("is_current = ? AND date >= ? AND date <= ?", true, from, to).
+		Group("merchant_id, DATE(date), currency").
+		Scan(&totals).
+		Error
+
+	if err != nil {
+		return nil, fmt.Errorf("gagal menghitung total harian settlement: %w", err)
+	}
+
+	return totals, nil
+}
+
+func (r *settlementRepo) ListByRun(ctx context.Context, runID string) ([]models.Settlement, error) {
+	var rows []models.Settlement
+	err := r.db.WithContext(ctx).
+		Where("run_id = ?", runID).
+		Order("merchant_id, date, currency").
+		Find(&rows).Error
+	return rows, err
+}
+
+// ListCurrent returns the current versions in [from, to]. A zero merchantID
+// returns every merchant.
+func (r *settlementRepo) ListCurrent(ctx context.Context, merchantID uint64, from, to time.Time) ([]models.Settlement, error) {
+	var rows []models.Settlement
+	q := r.db.WithContext(ctx).
+		Where("is_current = ? AND date >= ? AND date <= ?", true, from, to)
+	if merchantID != 0 {
+		q = q.Where("merchant_id = ?", merchantID)
+	}
+	err := q.Order("merchant_id, date, currency").Find(&rows).Error
+	return rows, err
+}
+
+func (r *settlementRepo) ListVersions(ctx context.Context, merchantID uint64, date time.Time) ([]models.Settlement, error) {
+	var rows []models.Settlement
+	err := r.db.WithContext(ctx).
+		Where("merchant_id = ? AND date = ?", merchantID, date).
+		Order("currency, version DESC").
+		Find(&rows).Error
+	return rows, err
+}
+
+// GetCheckpoint returns nil when the job has not checkpointed yet.
+func (r *settlementRepo) GetCheckpoint(ctx context.Context, jobID string) (*models.SettlementCheckpoint, error) {
+	var cp models.SettlementCheckpoint
+	err := r.db.WithContext(ctx).Where("job_id = ?", jobID).First(&cp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (r *settlementRepo) SaveCheckpoint(ctx context.Context, cp *models.SettlementCheckpoint) error {
+	cp.UpdatedAt = time.Now()
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(cp).Error
+}
+
+func (r *settlementRepo) DeleteCheckpoint(ctx context.Context, jobID string) error {
+	return r.db.WithContext(ctx).Where("job_id = ?", jobID).Delete(&models.SettlementCheckpoint{}).Error
 }
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"indico-be/internal/models"
+)
+
+func settlementRows(n int) []*models.Settlement {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	rows := make([]*models.Settlement, n)
+	for i := range rows {
+		rows[i] = &models.Settlement{
+			MerchantID: uint64(i + 1), Date: day, Currency: "IDR",
+			GrossCents: 1000, FeeCents: 10, NetCents: 990, TxnCount: 3,
+			SettlementCurrency: "USD", FxRate: "0.000064",
+			SettledGrossCents: 6, SettledFeeCents: 0, SettledNetCents: 6,
+			GeneratedAt: day, RunID: "run-1",
+		}
+	}
+	return rows
+}
+
+func TestSaveVersionsStatement(t *testing.T) {
+	db, fake := newFakeDB(t, func(q string, args []driver.Value) (fakeResult, error) {
+		if strings.Contains(q, "FOR UPDATE") {
+			return fakeResult{Columns: []string{"id"}}, nil
+		}
+		return fakeResult{Affected: 1}, nil
+	})
+	repo := NewSettlementRepo(db)
+
+	rows := settlementRows(3)
+	err := repo.InTx(context.Background(), func(repo SettlementRepository) error {
+		return repo.SaveVersions(context.Background(), rows, 2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every chunk locks its keys before numbering them, inside the caller's
+	// transaction.
+	var got []string
+	for _, s := range fake.statements("") {
+		switch {
+		case s.Tx != "":
+			got = append(got, s.Tx)
+		case strings.Contains(s.Query, "FOR UPDATE"):
+			got = append(got, "LOCK")
+		case strings.Contains(s.Query, "INSERT INTO settlements"):
+			got = append(got, "INSERT")
+		}
+	}
+	want := "BEGIN LOCK INSERT LOCK INSERT COMMIT"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("statements = %v, want %s", got, want)
+	}
+
+	locks := fake.statements("FOR UPDATE")
+	if n := len(locks[0].Args); n != 2*3 {
+		t.Errorf("first lock has %d args, want 6", n)
+	}
+	if locks[1].Args[0] != int64(3) {
+		t.Errorf("second lock starts at merchant %v, want 3", locks[1].Args[0])
+	}
+
+	inserts := fake.statements("INSERT INTO settlements")
+	for i, ins := range inserts {
+		if n := strings.Count(ins.Query, "?"); n != len(ins.Args) {
+			t.Errorf("insert %d: %d placeholders for %d args", i, n, len(ins.Args))
+		}
+	}
+	if n := len(inserts[0].Args); n != 2*14 {
+		t.Errorf("first chunk has %d args, want 28", n)
+	}
+	first := inserts[0].Args
+	for i, want := range []driver.Value{int64(1), rows[0].Date, "IDR", int64(1000), int64(10), int64(990), int64(3),
+		"USD", "0.000064", int64(6), int64(0), int64(6), rows[0].Date, "run-1"} {
+		if first[i] != want {
+			t.Errorf("arg %d = %v, want %v", i, first[i], want)
+		}
+	}
+}
+
+func TestSaveVersionsOnDuplicateKey(t *testing.T) {
+	db, fake := newFakeDB(t, func(q string, args []driver.Value) (fakeResult, error) {
+		return fakeResult{Columns: []string{"id"}, Affected: 1}, nil
+	})
+	if err := NewSettlementRepo(db).SaveVersion(context.Background(), settlementRows(1)[0]); err != nil {
+		t.Fatal(err)
+	}
+	inserts := fake.statements("INSERT INTO settlements")
+	if len(inserts) != 1 {
+		t.Fatalf("got %d inserts, want 1", len(inserts))
+	}
+	q := inserts[0].Query
+
+	// A retry of the same run hits uk_merchant_date_run and refreshes the
+	// numbers; the key, run, version and current flag stay as they are.
+	_, update, ok := strings.Cut(q, "ON DUPLICATE KEY UPDATE")
+	if !ok {
+		t.Fatalf("no ON DUPLICATE KEY UPDATE in %s", q)
+	}
+	set := map[string]bool{}
+	for _, m := range regexp.MustCompile(`(\w+) = VALUES\((\w+)\)`).FindAllStringSubmatch(update, -1) {
+		if m[1] != m[2] {
+			t.Errorf("%s is set from VALUES(%s)", m[1], m[2])
+		}
+		set[m[1]] = true
+	}
+	for _, col := range []string{"gross_cents", "fee_cents", "net_cents", "txn_count", "settlement_currency", "fx_rate",
+		"settled_gross_cents", "settled_fee_cents", "settled_net_cents", "generated_at"} {
+		if !set[col] {
+			t.Errorf("%s is not refreshed on retry", col)
+		}
+	}
+	for _, col := range []string{"merchant_id", "date", "currency", "run_id", "version", "is_current"} {
+		if regexp.MustCompile(`\b` + col + ` =`).MatchString(update) {
+			t.Errorf("%s is overwritten on duplicate key", col)
+		}
+	}
+
+	// New versions are numbered after the latest of their own key and start
+	// out not current.
+	if !strings.Contains(q, "COALESCE(MAX(s.version), 0) + 1") ||
+		!strings.Contains(q, "s.merchant_id = v.merchant_id AND s.date = v.date AND s.currency = v.currency") {
+		t.Errorf("version is not numbered per merchant/day/currency: %s", q)
+	}
+
+	// SaveVersion locks too, so it opens its own transaction.
+	all := fake.statements("")
+	if all[0].Tx != "BEGIN" || all[len(all)-1].Tx != "COMMIT" {
+		t.Errorf("SaveVersion ran outside a transaction: %+v", all)
+	}
+}
+
+func TestLockWatermarkInTx(t *testing.T) {
+	db, fake := newFakeDB(t, func(q string, args []driver.Value) (fakeResult, error) {
+		return fakeResult{Columns: []string{"stream"}}, nil
+	})
+	repo := NewSettlementRepo(db)
+
+	var wm *models.SettlementWatermark
+	err := repo.InTx(context.Background(), func(repo SettlementRepository) error {
+		var err error
+		wm, err = repo.LockWatermark(context.Background(), "default")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wm != nil {
+		t.Errorf("watermark = %+v, want nil for a new stream", wm)
+	}
+
+	var got []string
+	for _, s := range fake.statements("") {
+		switch {
+		case s.Tx != "":
+			got = append(got, s.Tx)
+		case strings.Contains(s.Query, "settlement_watermarks") && strings.HasSuffix(strings.TrimSpace(s.Query), "FOR UPDATE"):
+			got = append(got, "LOCK")
+		}
+	}
+	if want := "BEGIN LOCK COMMIT"; strings.Join(got, " ") != want {
+		t.Errorf("statements = %v, want %s", got, want)
+	}
+}
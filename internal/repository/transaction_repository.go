@@ -8,30 +8,78 @@ import (
 	"indico-be/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Transaction struct {
 	models.Transaction
 }
 
+// Cursor is a keyset position in (paid_at, id) order. The zero value starts
+// at the beginning of a period.
+type Cursor struct {
+	PaidAt time.Time `json:"paid_at"`
+	ID     uint64    `json:"id"`
+}
+
+func (c Cursor) IsZero() bool { return c.ID == 0 && c.PaidAt.IsZero() }
+
+// After reports whether c is strictly past o.
+func (c Cursor) After(o Cursor) bool {
+	if !c.PaidAt.Equal(o.PaidAt) {
+		return c.PaidAt.After(o.PaidAt)
+	}
+	return c.ID > o.ID
+}
+
+func (c Cursor) Equal(o Cursor) bool { return !c.After(o) && !o.After(c) }
+
 type TransactionRepository interface {
 	FetchBatch(ctx context.Context, offset, limit int) ([]models.Transaction, error)
 	CountAll(ctx context.Context) (int64, error)
 	CountByPeriod(ctx context.Context, from, to time.Time) (int64, error)
 	GetBatch(ctx context.Context, from, to time.Time, offset, limit int) ([]Transaction, error)
+	CountAfter(ctx context.Context, from, to time.Time, after Cursor) (int64, error)
+	GetBatchAfter(ctx context.Context, from, to time.Time, after Cursor, limit int) ([]Transaction, error)
+	DailyTotals(ctx context.Context, from, to time.Time) ([]models.DailyTotal, error)
+	// List pages through transactions matching f in (paid_at, id) order.
+	List(ctx context.Context, f TransactionFilter) ([]models.Transaction, error)
+	// ExistingRefs returns which of refs are already stored.
+	ExistingRefs(ctx context.Context, refs []string) (map[string]bool, error)
+	// BulkInsert writes txs in multi-row inserts of chunkSize, skipping rows
+	// whose external_ref is already stored, and returns how many it wrote.
+	BulkInsert(ctx context.Context, txs []models.Transaction, chunkSize int) (int64, error)
+}
+
+// TransactionFilter narrows List. Zero fields do not filter; From and To
+// are inclusive.
+type TransactionFilter struct {
+	MerchantID uint64
+	Status     string
+	From       time.Time
+	To         time.Time
+	After      Cursor
+	Limit      int
 }
 
 type transactionRepo struct {
 	db *gorm.DB
+	// read serves every query but ExistingRefs, which guards inserts.
+	read *gorm.DB
 }
 
-func NewTransactionRepo(db *gorm.DB) TransactionRepository {
-	return &transactionRepo{db: db}
+// NewTransactionRepo writes to db and reads from read, e.g. a replica;
+// read nil reads from db.
+func NewTransactionRepo(db, read *gorm.DB) TransactionRepository {
+	if read == nil {
+		read = db
+	}
+	return &transactionRepo{db: db, read: read}
 }
 
 func (r *transactionRepo) FetchBatch(ctx context.Context, offset, limit int) ([]models.Transaction, error) {
 	var txs []models.Transaction
-	err := r.db.WithContext(ctx).
+	err := r.read.WithContext(ctx).
 		Order("id").
 		Offset(offset).
 		Limit(limit).
@@ -41,14 +89,14 @@ func (r *transactionRepo) FetchBatch(ctx context.Context, offset, limit int) ([]
 
 func (r *transactionRepo) CountAll(ctx context.Context) (int64, error) {
 	var cnt int64
-	err := r.db.WithContext(ctx).Model(&models.Transaction{}).Count(&cnt).Error
+	err := r.read.WithContext(ctx).Model(&models.Transaction{}).Count(&cnt).Error
 	return cnt, err
 }
 
 func (r *transactionRepo) CountByPeriod(ctx context.Context, from, to time.Time) (int64, error) {
 	var count int64
 
-	err := r.db.WithContext(ctx).
+	err := r.read.WithContext(ctx).
 		Model(&Transaction{}).
 		Where("paid_at >= ? AND paid_at <= ?", from, to).
 		Count(&count).
@@ -64,7 +112,7 @@ func (r *transactionRepo) CountByPeriod(ctx context.Context, from, to time.Time)
 func (r *transactionRepo) GetBatch(ctx context.Context, from, to time.Time, offset, limit int) ([]Transaction, error) {
 	var transactions []Transaction
 
-	err := r.db.WithContext(ctx).
+	err := r.read.WithContext(ctx).
 		Model(&Transaction{}).
 		Where("paid_at >= ? AND paid_at <= ?", from, to).
 		Order("paid_at ASC").
@@ -79,3 +127,133 @@ func (r *transactionRepo) GetBatch(ctx context.Context, from, to time.Time, offs
 
 	return transactions, nil
 }
+
+// settledPeriod restricts a query to the paid transactions of [from, to];
+// pending, failed and refunded ones are never settled.
+func settledPeriod(q *gorm.DB, from, to time.Time) *gorm.DB {
+	return q.Where("status = ? AND paid_at >= ? AND paid_at <= ?", models.TxnPaid, from, to)
+}
+
+// periodAfter restricts a query to the paid transactions of [from, to] and,
+// unless after is zero, to rows strictly past the cursor.
+func periodAfter(q *gorm.DB, from, to time.Time, after Cursor) *gorm.DB {
+	q = settledPeriod(q, from, to)
+	if !after.IsZero() {
+		q = q.Where("(paid_at > ? OR (paid_at = ? AND id > ?))", after.PaidAt, after.PaidAt, after.ID)
+	}
+	return q
+}
+
+func (r *transactionRepo) CountAfter(ctx context.Context, from, to time.Time, after Cursor) (int64, error) {
+	var count int64
+
+	err := periodAfter(r.read.WithContext(ctx).Model(&Transaction{}), from, to, after).
+		Count(&count).
+		Error
+
+	if err != nil {
+		return 0, fmt.Errorf("gagal menghitung transaksi: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetBatchAfter pages through a period in (paid_at, id) order. Unlike
+// GetBatch it does not skip or repeat rows when transactions share a paid_at.
+func (r *transactionRepo) GetBatchAfter(ctx context.Context, from, to time.Time, after Cursor, limit int) ([]Transaction, error) {
+	var transactions []Transaction
+
+	err := periodAfter(r.read.WithContext(ctx).Model(&Transaction{}), from, to, after).
+		Order("paid_at ASC, id ASC").
+		Limit(limit).
+		Find(&transactions).
+		Error
+
+	if err != nil {
+		return nil, fmt.Errorf("gagal mengambil batch transaksi: %w", err)
+	}
+
+	return transactions, nil
+}
+
+func (r *transactionRepo) DailyTotals(ctx context.Context, from, to time.Time) ([]models.DailyTotal, error) {
+	var totals []models.DailyTotal
+
+	err := settledPeriod(r.read.WithContext(ctx).Model(&Transaction{}), from, to).
+		Select("merchant_id, DATE(paid_at) AS date, currency, COUNT(*) AS txn_count, SUM(amount_cents) AS gross_cents, SUM(fee_cents) AS fee_cents").
+		Group("merchant_id, DATE(paid_at), currency").
+		Scan(&totals).
+		Error
+
+	if err != nil {
+		return nil, fmt.Errorf("gagal menghitung total harian transaksi: %w", err)
+	}
+
+	return totals, nil
+}
+
+func (r *transactionRepo) List(ctx context.Context, f TransactionFilter) ([]models.Transaction, error) {
+	q := r.read.WithContext(ctx).Model(&Transaction{})
+	if f.MerchantID != 0 {
+		q = q.Where("merchant_id = ?", f.MerchantID)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if !f.From.IsZero() {
+		q = q.Where("paid_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q = q.Where("paid_at <= ?", f.To)
+	}
+	if !f.After.IsZero() {
+		q = q.Where("(paid_at > ? OR (paid_at = ? AND id > ?))", f.After.PaidAt, f.After.PaidAt, f.After.ID)
+	}
+
+	var txs []models.Transaction
+	err := q.Order("paid_at ASC, id ASC").Limit(f.Limit).Find(&txs).Error
+	if err != nil {
+		return nil, fmt.Errorf("gagal mengambil transaksi: %w", err)
+	}
+	return txs, nil
+}
+
+func (r *transactionRepo) ExistingRefs(ctx context.Context, refs []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(refs) == 0 {
+		return existing, nil
+	}
+
+	var found []string
+	err := r.db.WithContext(ctx).
+		Model(&Transaction{}).
+		Where("external_ref IN ?", refs).
+		Pluck("external_ref", &found).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("gagal memeriksa external_ref: %w", err)
+	}
+	for _, ref := range found {
+		existing[ref] = true
+	}
+	return existing, nil
+}
+
+// BulkInsert relies on uk_external_ref, so concurrent pushes of the same
+// transaction still store it once.
+func (r *transactionRepo) BulkInsert(ctx context.Context, txs []models.Transaction, chunkSize int) (int64, error) {
+	if len(txs) == 0 {
+		return 0, nil
+	}
+	if chunkSize <= 0 {
+		chunkSize = 1000
+	}
+
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(txs, chunkSize)
+	if res.Error != nil {
+		return 0, fmt.Errorf("gagal menyimpan transaksi: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"indico-be/internal/models"
+)
+
+var paidPeriod = regexp.MustCompile(`WHERE \(?status = \? AND paid_at >= \? AND paid_at <= \?`)
+
+// TestSettlementScansOnlyPaid checks that every query settlement and
+// reconciliation sum over filters on status = paid.
+func TestSettlementScansOnlyPaid(t *testing.T) {
+	db, fake := newFakeDB(t, func(q string, args []driver.Value) (fakeResult, error) {
+		if strings.HasPrefix(q, "SELECT count(*)") {
+			return fakeResult{Columns: []string{"count"}, Rows: [][]driver.Value{{int64(0)}}}, nil
+		}
+		return fakeResult{Columns: []string{"id"}}, nil
+	})
+	repo := NewTransactionRepo(db, nil)
+	ctx := context.Background()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1).Add(-time.Microsecond)
+	after := Cursor{PaidAt: from.Add(time.Hour), ID: 9}
+
+	if _, err := repo.CountAfter(ctx, from, to, after); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetBatchAfter(ctx, from, to, after, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.DailyTotals(ctx, from, to); err != nil {
+		t.Fatal(err)
+	}
+
+	stmts := fake.statements("FROM `transactions`")
+	if len(stmts) != 3 {
+		t.Fatalf("got %d statements, want 3", len(stmts))
+	}
+	for _, s := range stmts {
+		if !paidPeriod.MatchString(s.Query) {
+			t.Errorf("%s\ndoes not filter on status first", s.Query)
+			continue
+		}
+		if s.Args[0] != models.TxnPaid {
+			t.Errorf("%s\nstatus = %v, want %q", s.Query, s.Args[0], models.TxnPaid)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"indico-be/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type WebhookSubscription struct {
+	models.WebhookSubscription
+}
+
+type WebhookDelivery struct {
+	models.WebhookDelivery
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, s *models.WebhookSubscription) error
+	ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id uint64) (*models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id uint64) error
+
+	// UnnotifiedJobs lists jobs in one of statuses whose deliveries were
+	// not created yet, oldest first.
+	UnnotifiedJobs(ctx context.Context, statuses []string, limit int) ([]string, error)
+	// CreateJobDeliveries marks a job notified and stores its deliveries in
+	// one transaction. false means another dispatcher already did, or the
+	// job is no longer in one of statuses.
+	CreateJobDeliveries(ctx context.Context, jobID string, statuses []string, ds []models.WebhookDelivery) (bool, error)
+	GetDelivery(ctx context.Context, id uint64) (*models.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, jobID, status string, limit int) ([]models.WebhookDelivery, error)
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	ClaimDelivery(ctx context.Context, d *models.WebhookDelivery, leaseUntil time.Time) (bool, error)
+	SaveAttempt(ctx context.Context, d *models.WebhookDelivery) error
+	Redeliver(ctx context.Context, id uint64) error
+}
+
+type webhookRepo struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepo(db *gorm.DB) WebhookRepository {
+	return &webhookRepo{db: db}
+}
+
+func (r *webhookRepo) CreateSubscription(ctx context.Context, s *models.WebhookSubscription) error {
+	return r.db.WithContext(ctx).Create(s).Error
+}
+
+func (r *webhookRepo) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var rows []models.WebhookSubscription
+	err := r.db.WithContext(ctx).Order("id").Find(&rows).Error
+	return rows, err
+}
+
+func (r *webhookRepo) GetSubscription(ctx context.Context, id uint64) (*models.WebhookSubscription, error) {
+	var s models.WebhookSubscription
+	if err := r.db.WithContext(ctx).First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *webhookRepo) DeleteSubscription(ctx context.Context, id uint64) error {
+	res := r.db.WithContext(ctx).Delete(&models.WebhookSubscription{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *webhookRepo) UnnotifiedJobs(ctx context.Context, statuses []string, limit int) ([]string, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).
+		Table("job_records").
+		Where("notified_at IS NULL AND status IN ?", statuses).
+		Order("updated_at").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *webhookRepo) CreateJobDeliveries(ctx context.Context, jobID string, statuses []string, ds []models.WebhookDelivery) (bool, error) {
+	won := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table("job_records").
+			Where("id = ? AND notified_at IS NULL AND status IN ?", jobID, statuses).
+			Update("notified_at", time.Now())
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		won = true
+		if len(ds) == 0 {
+			return nil
+		}
+		return tx.Create(&ds).Error
+	})
+	return won && err == nil, err
+}
+
+func (r *webhookRepo) GetDelivery(ctx context.Context, id uint64) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	if err := r.db.WithContext(ctx).First(&d, id).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *webhookRepo) ListDeliveries(ctx context.Context, jobID, status string, limit int) ([]models.WebhookDelivery, error) {
+	var rows []models.WebhookDelivery
+	q := r.db.WithContext(ctx)
+	if jobID != "" {
+		q = q.Where("job_id = ?", jobID)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Order("id DESC").Limit(limit).Find(&rows).Error
+	return rows, err
+}
+
+func (r *webhookRepo) ListDue(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var rows []models.WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&rows).Error
+	return rows, err
+}
+
+// ClaimDelivery pushes next_attempt_at to leaseUntil while it still has the
+// value that was read, so only one replica sends a given attempt.
+func (r *webhookRepo) ClaimDelivery(ctx context.Context, d *models.WebhookDelivery, leaseUntil time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", d.ID, models.DeliveryPending, d.NextAttemptAt).
+		Update("next_attempt_at", leaseUntil)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *webhookRepo) SaveAttempt(ctx context.Context, d *models.WebhookDelivery) error {
+	d.UpdatedAt = time.Now()
+	return r.db.WithContext(ctx).
+		Model(&models.WebhookDelivery{}).
+		Where("id = ?", d.ID).
+		Updates(map[string]interface{}{
+			"status":          d.Status,
+			"attempts":        d.Attempts,
+			"response_code":   d.ResponseCode,
+			"last_error":      d.LastError,
+			"next_attempt_at": d.NextAttemptAt,
+			"delivered_at":    d.DeliveredAt,
+			"updated_at":      d.UpdatedAt,
+		}).Error
+}
+
+// Redeliver queues a delivery again with a fresh retry budget.
+func (r *webhookRepo) Redeliver(ctx context.Context, id uint64) error {
+	now := time.Now()
+	res := r.db.WithContext(ctx).
+		Model(&models.WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":          models.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+			"updated_at":      now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"indico-be/internal/job"
+	"indico-be/internal/models"
+	"indico-be/internal/service"
+)
+
+// Enqueuer is the part of job.JobQueue the scheduler needs.
+type Enqueuer interface {
+	NewRecord(req job.EnqueueRequest) (*models.Job, error)
+	Submitted(rec *models.Job)
+}
+
+// Scheduler polls the schedules table and enqueues a settlement job for every
+// due schedule. Ticks are claimed in the database, so running it on several
+// replicas still enqueues one job per tick.
+type Scheduler struct {
+	svc      *service.ScheduleService
+	queue    Enqueuer
+	interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func New(svc *service.ScheduleService, q Enqueuer, interval time.Duration) *Scheduler {
+	return &Scheduler{svc: svc, queue: q, interval: interval}
+}
+
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			s.runDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits for the current poll to finish.
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+func (s *Scheduler) runDue(ctx context.Context) {
+	now := time.Now()
+	due, err := s.svc.ListDue(ctx, now)
+	if err != nil {
+		log.Printf("[scheduler] gagal mengambil schedule: %v", err)
+		return
+	}
+
+	for i := range due {
+		sch := &due[i]
+		rec, from, to, err := s.newJob(sch)
+		if err != nil {
+			// The tick stays due, so the next poll (here or on another
+			// replica) tries again instead of skipping this settlement.
+			log.Printf("[scheduler] schedule %d enqueue error, retrying next poll: %v", sch.ID, err)
+			continue
+		}
+		won, err := s.svc.Claim(ctx, sch, now, rec)
+		if err != nil {
+			log.Printf("[scheduler] schedule %d claim error: %v", sch.ID, err)
+			continue
+		}
+		if !won {
+			continue
+		}
+		s.queue.Submitted(rec)
+		log.Printf("[scheduler] schedule %q enqueued job %s (%s → %s)", sch.Name, rec.ID, from, to)
+	}
+}
+
+// newJob builds the settlement job of sch's current tick; Claim stores it
+// with the tick. Scheduled jobs skip the capacity check: a full queue
+// delays them instead of losing them.
+func (s *Scheduler) newJob(sch *models.Schedule) (rec *models.Job, from, to string, err error) {
+	from, to, err = s.svc.Window(sch, sch.NextRunAt)
+	if err != nil {
+		return nil, "", "", err
+	}
+	req, err := job.SettlementJob(from, to, s.svc.RunOptions(sch))
+	if err != nil {
+		return nil, "", "", err
+	}
+	req.Queue = job.QueueDefault
+	req.Tenant = "scheduler"
+	req.SkipCapacity = true
+	rec, err = s.queue.NewRecord(req)
+	return rec, from, to, err
+}
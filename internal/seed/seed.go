@@ -0,0 +1,312 @@
+package seed
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+)
+
+// maxBatch keeps one multi-row insert of 7 columns under MySQL's 65535
+// placeholder limit.
+const maxBatch = 9000
+
+// Weighted is one choice of a mix and its relative weight.
+type Weighted struct {
+	Value  string
+	Weight int
+}
+
+// ParseMix reads "paid=90,failed=10" into weighted choices.
+func ParseMix(raw string) ([]Weighted, error) {
+	var out []Weighted
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		value, w, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(w)
+		if !ok || err != nil || n < 0 || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid mix entry %q, want value=weight", pair)
+		}
+		if n > 0 {
+			out = append(out, Weighted{Value: strings.TrimSpace(value), Weight: n})
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("mix has no entry with a positive weight")
+	}
+	return out, nil
+}
+
+// Options describes a dataset. The same options always produce the same
+// transactions, in the same order.
+type Options struct {
+	Rows       int
+	Merchants  int
+	Start      time.Time
+	Days       int
+	Statuses   []Weighted
+	Currencies []Weighted
+	Seed       int64
+	Batch      int
+}
+
+func (o Options) validate() error {
+	switch {
+	case o.Rows <= 0:
+		return errors.New("rows must be positive")
+	case o.Merchants <= 0:
+		return errors.New("merchants must be positive")
+	case o.Days <= 0:
+		return errors.New("days must be positive")
+	case o.Batch <= 0 || o.Batch > maxBatch:
+		return fmt.Errorf("batch must be between 1 and %d", maxBatch)
+	case len(o.Statuses) == 0 || len(o.Currencies) == 0:
+		return errors.New("statuses and currencies need at least one entry")
+	}
+	return nil
+}
+
+// Generator yields the transactions of a dataset one by one.
+type Generator struct {
+	opts Options
+	rng  *rand.Rand
+	n    int
+}
+
+func NewGenerator(opts Options) *Generator {
+	return &Generator{opts: opts, rng: rand.New(rand.NewSource(opts.Seed))}
+}
+
+// Next returns the next transaction, or false once Rows were generated.
+// external_ref is derived from the seed, start day and position, so
+// inserting a dataset twice stores it once.
+func (g *Generator) Next() (models.Transaction, bool) {
+	if g.n >= g.opts.Rows {
+		return models.Transaction{}, false
+	}
+	g.n++
+
+	span := int64(g.opts.Days) * int64(24*time.Hour/time.Millisecond)
+	// The start day is part of the ref: the default start moves every day,
+	// and the same refs with other paid_at values would be skipped as
+	// duplicates.
+	ref := fmt.Sprintf("seed-%d-%s-%d", g.opts.Seed, g.opts.Start.Format("20060102"), g.n)
+	merchant := uint64(g.rng.Intn(g.opts.Merchants) + 1)
+	cur := pick(g.rng, g.opts.Currencies)
+	amount := int64(g.rng.Intn(10_000) + 100)
+	fee := int64(g.rng.Intn(500))
+	if fee > amount {
+		fee = amount
+	}
+	return models.Transaction{
+		ExternalRef: &ref,
+		MerchantID:  merchant,
+		Currency:    cur,
+		AmountCents: amount,
+		FeeCents:    fee,
+		Status:      pick(g.rng, g.opts.Statuses),
+		// Millisecond precision, like paid_at in the database.
+		PaidAt: g.opts.Start.Add(time.Duration(g.rng.Int63n(span)) * time.Millisecond),
+	}, true
+}
+
+func pick(rng *rand.Rand, mix []Weighted) string {
+	total := 0
+	for _, w := range mix {
+		total += w.Weight
+	}
+	n := rng.Intn(total)
+	for _, w := range mix {
+		if n < w.Weight {
+			return w.Value
+		}
+		n -= w.Weight
+	}
+	return mix[len(mix)-1].Value
+}
+
+// Sink receives a dataset batch by batch.
+type Sink interface {
+	Write(ctx context.Context, batch []models.Transaction) error
+	Close() error
+}
+
+// Run generates the dataset described by opts and hands every batch to each
+// sink, then closes the sinks. progress, if set, is called after each batch
+// with the rows so far.
+func Run(ctx context.Context, opts Options, sinks []Sink, progress func(done int)) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	err := generate(ctx, opts, sinks, progress)
+	for _, s := range sinks {
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func generate(ctx context.Context, opts Options, sinks []Sink, progress func(done int)) error {
+	gen := NewGenerator(opts)
+	batch := make([]models.Transaction, 0, opts.Batch)
+	done := 0
+	flush := func() error {
+		for _, s := range sinks {
+			if err := s.Write(ctx, batch); err != nil {
+				return err
+			}
+		}
+		done += len(batch)
+		batch = batch[:0]
+		if progress != nil {
+			progress(done)
+		}
+		return ctx.Err()
+	}
+
+	for {
+		t, ok := gen.Next()
+		if !ok {
+			break
+		}
+		batch = append(batch, t)
+		if len(batch) == opts.Batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+type dbSink struct {
+	repo     repository.TransactionRepository
+	batch    int
+	inserted int64
+}
+
+// NewDBSink bulk-inserts batches through repo. Rows already stored (same
+// external_ref) are skipped.
+func NewDBSink(repo repository.TransactionRepository, batch int) Sink {
+	return &dbSink{repo: repo, batch: batch}
+}
+
+func (s *dbSink) Write(ctx context.Context, batch []models.Transaction) error {
+	// BulkInsert fills in IDs; keep the batch untouched for other sinks.
+	rows := append([]models.Transaction(nil), batch...)
+	n, err := s.repo.BulkInsert(ctx, rows, s.batch)
+	s.inserted += n
+	return err
+}
+
+func (s *dbSink) Close() error { return nil }
+
+// Inserted reports how many rows a DB sink stored.
+func Inserted(s Sink) int64 {
+	if db, ok := s.(*dbSink); ok {
+		return db.inserted
+	}
+	return 0
+}
+
+// fileSink writes a fixture in the transaction import formats: CSV with a
+// header row, or NDJSON.
+type fileSink struct {
+	f   *os.File
+	csv *csv.Writer
+	enc *json.Encoder
+}
+
+// NewFileSink writes to path; .csv writes CSV, .ndjson and .jsonl NDJSON.
+func NewFileSink(path string) (Sink, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".csv" && ext != ".ndjson" && ext != ".jsonl" {
+		return nil, fmt.Errorf("fixture %s must end in .csv, .ndjson or .jsonl", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating fixture: %w", err)
+	}
+
+	s := &fileSink{f: f}
+	if ext == ".csv" {
+		s.csv = csv.NewWriter(f)
+		err = s.csv.Write([]string{"external_ref", "merchant_id", "currency", "amount_cents", "fee_cents", "status", "paid_at"})
+	} else {
+		s.enc = json.NewEncoder(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) Write(_ context.Context, batch []models.Transaction) error {
+	for _, t := range batch {
+		if s.enc != nil {
+			if err := s.enc.Encode(fixtureRow(t)); err != nil {
+				return err
+			}
+			continue
+		}
+		err := s.csv.Write([]string{
+			*t.ExternalRef,
+			strconv.FormatUint(t.MerchantID, 10),
+			t.Currency,
+			strconv.FormatInt(t.AmountCents, 10),
+			strconv.FormatInt(t.FeeCents, 10),
+			t.Status,
+			t.PaidAt.UTC().Format(time.RFC3339Nano),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			s.f.Close()
+			return err
+		}
+	}
+	return s.f.Close()
+}
+
+// fixtureRow leaves out the database id, which differs between databases.
+func fixtureRow(t models.Transaction) interface{} {
+	return struct {
+		ExternalRef string    `json:"external_ref"`
+		MerchantID  uint64    `json:"merchant_id"`
+		Currency    string    `json:"currency"`
+		AmountCents int64     `json:"amount_cents"`
+		FeeCents    int64     `json:"fee_cents"`
+		Status      string    `json:"status"`
+		PaidAt      time.Time `json:"paid_at"`
+	}{*t.ExternalRef, t.MerchantID, t.Currency, t.AmountCents, t.FeeCents, t.Status, t.PaidAt.UTC()}
+}
@@ -0,0 +1,10 @@
+package service
+
+// ValidationError marks errors caused by bad input rather than by storage.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
@@ -0,0 +1,524 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+)
+
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+
+	// importDir holds uploaded files, named by content hash. It is not
+	// served over HTTP.
+	importDir = "uploads/imports"
+)
+
+// importFields are the transaction fields an import reads; all but
+// currency are required.
+var importFields = []string{"external_ref", "merchant_id", "currency", "amount_cents", "fee_cents", "status", "paid_at"}
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ImportOptions describes one uploaded transaction file.
+type ImportOptions struct {
+	SHA256   string `json:"sha256"`
+	Format   string `json:"format"`
+	Filename string `json:"filename,omitempty"`
+	// Columns maps a transaction field to the CSV header or NDJSON key
+	// holding it, e.g. {"amount_cents": "Amount"}; unmapped fields are read
+	// from a column of their own name.
+	Columns map[string]string `json:"columns,omitempty"`
+	// PaidAtLayout is the Go time layout of paid_at; RFC 3339 by default.
+	PaidAtLayout string `json:"paid_at_layout,omitempty"`
+}
+
+// Normalize validates the options and fills in defaults.
+func (o *ImportOptions) Normalize() error {
+	o.SHA256 = strings.ToLower(o.SHA256)
+	if !sha256Hex.MatchString(o.SHA256) {
+		return errors.New("sha256 must be 64 hex characters")
+	}
+	o.Format = strings.ToLower(o.Format)
+	if o.Format != ImportCSV && o.Format != ImportNDJSON {
+		return fmt.Errorf("format must be %s or %s", ImportCSV, ImportNDJSON)
+	}
+	for field := range o.Columns {
+		if !knownImportField(field) {
+			return fmt.Errorf("unknown column mapping %q", field)
+		}
+	}
+	if o.PaidAtLayout == "" {
+		o.PaidAtLayout = time.RFC3339Nano
+	}
+	if _, err := os.Stat(o.path()); err != nil {
+		return fmt.Errorf("no uploaded file for sha256 %s", o.SHA256)
+	}
+	return nil
+}
+
+func (o *ImportOptions) path() string {
+	return filepath.Join(importDir, o.SHA256+"."+o.Format)
+}
+
+func (o *ImportOptions) column(field string) string {
+	if c, ok := o.Columns[field]; ok && c != "" {
+		return c
+	}
+	return field
+}
+
+func knownImportField(field string) bool {
+	for _, f := range importFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportService imports uploaded transaction files. A file is identified by
+// the SHA-256 of its content, so uploading it again returns the first
+// import instead of starting another.
+type ImportService struct {
+	txs  *TransactionService
+	repo repository.ImportRepository
+	jobs *JobService
+	// jobRepo tells whether an earlier import of the same file failed.
+	jobRepo   repository.JobRepository
+	exportDir string
+}
+
+func NewImportService(txs *TransactionService, repo repository.ImportRepository, jobs *JobService, jobRepo repository.JobRepository) *ImportService {
+	return &ImportService{txs: txs, repo: repo, jobs: jobs, jobRepo: jobRepo, exportDir: "public/downloads"}
+}
+
+// SetExportDir sets where rejects files are written.
+func (s *ImportService) SetExportDir(dir string) {
+	s.exportDir = dir
+}
+
+// Store saves an upload under its content hash and returns the hash.
+func (s *ImportService) Store(r io.Reader, format string) (string, error) {
+	if err := os.MkdirAll(importDir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create %s directory: %w", importDir, err)
+	}
+	tmp, err := os.CreateTemp(importDir, "upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed storing upload: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed storing upload: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed storing upload: %w", err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	opts := ImportOptions{SHA256: sum, Format: format}
+	if err := os.Rename(tmp.Name(), opts.path()); err != nil {
+		return "", fmt.Errorf("failed storing upload: %w", err)
+	}
+	return sum, nil
+}
+
+// Register records an import of imp.SHA256 and stores job, the QUEUED job
+// importing it, in the same transaction. When the same content was
+// registered before it returns that import and true, unless its job failed
+// or was cancelled, in which case the import is handed to job instead. An
+// import without a job predates jobs being stored with it; it was left by
+// an upload that died before submitting, and is handed over too.
+func (s *ImportService) Register(ctx context.Context, imp *models.TransactionImport, job *models.Job) (*models.TransactionImport, bool, error) {
+	for {
+		created, err := s.repo.Create(ctx, imp, job)
+		if err != nil || created {
+			return imp, false, err
+		}
+
+		prev, err := s.repo.Get(ctx, imp.SHA256)
+		if err != nil {
+			return nil, false, err
+		}
+		if prev.JobID != "" {
+			j, err := s.jobRepo.GetByID(ctx, prev.JobID)
+			if err != nil {
+				return nil, false, err
+			}
+			if j.Status != models.JobFailed && j.Status != models.JobCanceled {
+				return prev, true, nil
+			}
+		}
+		replaced, err := s.repo.Replace(ctx, imp.SHA256, prev.JobID, job)
+		if err != nil {
+			return nil, false, err
+		}
+		if replaced {
+			prev.JobID = job.ID
+			return prev, false, nil
+		}
+		// Another upload replaced it first; look again.
+	}
+}
+
+func (s *ImportService) Get(ctx context.Context, sha256 string) (*models.TransactionImport, error) {
+	return s.repo.Get(ctx, sha256)
+}
+
+// importStats counts the rows of one import run.
+type importStats struct {
+	total, inserted, duplicates, rejected int64
+}
+
+// RunJob imports the file described by opts in chunks of ingestChunk rows
+// and returns the terminal status and the path of the rejects file, if any
+// row was rejected. Rows are deduplicated on external_ref, so a rerun after
+// an interruption or failure does not store anything twice.
+func (s *ImportService) RunJob(ctx context.Context, jobID string, opts ImportOptions) (models.JobStatus, string, error) {
+	if err := opts.Normalize(); err != nil {
+		return "", "", err
+	}
+	progress := s.jobs.tracker(jobID, importPhases)
+
+	progress.Start(ctx, PhaseCounting, 1)
+	total, err := countImportRows(opts)
+	if err != nil {
+		return "", "", err
+	}
+	progress.SetTotal(total)
+	if err := s.jobs.UpdateTotal(ctx, jobID, total); err != nil {
+		return "", "", fmt.Errorf("failed updating total: %w", err)
+	}
+
+	f, err := os.Open(opts.path())
+	if err != nil {
+		return "", "", fmt.Errorf("failed opening import: %w", err)
+	}
+	defer f.Close()
+	rows, err := newImportReader(f, opts)
+	if err != nil {
+		return "", "", err
+	}
+
+	rejects, err := newRejectsFile(s.exportDir, jobID)
+	if err != nil {
+		return "", "", err
+	}
+	defer rejects.close()
+
+	progress.Start(ctx, PhaseImporting, total)
+	var (
+		stats importStats
+		chunk = make([]models.Transaction, 0, ingestChunk)
+		read  int64
+	)
+	flush := func() error {
+		inserted, duplicates, err := s.txs.store(ctx, chunk)
+		if err != nil {
+			return err
+		}
+		stats.inserted += inserted
+		stats.duplicates += duplicates
+		progress.Advance(ctx, read)
+		chunk, read = chunk[:0], 0
+		return nil
+	}
+
+	for {
+		row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed reading import: %w", err)
+		}
+		stats.total++
+		read++
+
+		t, err := row.transaction(opts)
+		if err == nil {
+			err = ValidateTransaction(&t)
+		}
+		if err != nil {
+			stats.rejected++
+			ref := row.get(opts.column("external_ref"))
+			if err := rejects.write(row.line, ref, err, row.raw); err != nil {
+				return "", "", err
+			}
+			continue
+		}
+
+		chunk = append(chunk, t)
+		if len(chunk) == ingestChunk {
+			if err := ctx.Err(); err != nil {
+				return "", "", err
+			}
+			if err := flush(); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return "", "", err
+	}
+
+	if err := s.repo.SaveResult(ctx, opts.SHA256, stats.total, stats.inserted, stats.duplicates, stats.rejected); err != nil {
+		log.Printf("[Job %s] failed saving import result: %v", jobID, err)
+	}
+	progress.Complete(ctx)
+	log.Printf("[Job %s] IMPORTED %s: %d rows, %d inserted, %d duplicates, %d rejected",
+		jobID, opts.SHA256[:12], stats.total, stats.inserted, stats.duplicates, stats.rejected)
+
+	if stats.rejected == 0 {
+		return models.JobFinished, "", rejects.discard()
+	}
+	if err := rejects.close(); err != nil {
+		return "", "", err
+	}
+	return models.JobFinishedWithWarnings, "/jobs/downloads/" + filepath.Base(rejects.path), nil
+}
+
+// rejectsFile is the CSV listing every rejected row of an import: its line
+// in the uploaded file, external_ref, the reason, and the row as uploaded.
+type rejectsFile struct {
+	path   string
+	f      *os.File
+	w      *csv.Writer
+	closed bool
+}
+
+func newRejectsFile(dir, jobID string) (*rejectsFile, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create %s directory: %w", dir, err)
+	}
+	path := filepath.Join(dir, jobID+"-rejects.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating rejects file: %w", err)
+	}
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"line", "external_ref", "reason", "row"}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rejectsFile{path: path, f: f, w: w}, nil
+}
+
+func (r *rejectsFile) write(line int, ref string, reason error, raw string) error {
+	return r.w.Write([]string{strconv.Itoa(line), ref, reason.Error(), raw})
+}
+
+func (r *rejectsFile) close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.w.Flush()
+	if err := r.w.Error(); err != nil {
+		r.f.Close()
+		return fmt.Errorf("failed writing rejects file: %w", err)
+	}
+	return r.f.Close()
+}
+
+// discard removes the file of an import without rejects.
+func (r *rejectsFile) discard() error {
+	r.close()
+	return os.Remove(r.path)
+}
+
+// importRow is one row of an import file, with its 1-based line number.
+type importRow struct {
+	line   int
+	raw    string
+	values map[string]string
+	err    error
+}
+
+func (r importRow) get(column string) string {
+	return strings.TrimSpace(r.values[strings.ToLower(column)])
+}
+
+func (r importRow) transaction(opts ImportOptions) (models.Transaction, error) {
+	if r.err != nil {
+		return models.Transaction{}, &ValidationError{r.err}
+	}
+
+	var (
+		t   models.Transaction
+		err error
+	)
+	if ref := r.get(opts.column("external_ref")); ref != "" {
+		t.ExternalRef = &ref
+	}
+	if t.MerchantID, err = strconv.ParseUint(r.get(opts.column("merchant_id")), 10, 64); err != nil {
+		return t, &ValidationError{errors.New("invalid merchant_id")}
+	}
+	if t.AmountCents, err = strconv.ParseInt(r.get(opts.column("amount_cents")), 10, 64); err != nil {
+		return t, &ValidationError{errors.New("invalid amount_cents")}
+	}
+	if t.FeeCents, err = strconv.ParseInt(r.get(opts.column("fee_cents")), 10, 64); err != nil {
+		return t, &ValidationError{errors.New("invalid fee_cents")}
+	}
+	if t.PaidAt, err = time.Parse(opts.PaidAtLayout, r.get(opts.column("paid_at"))); err != nil {
+		return t, &ValidationError{errors.New("invalid paid_at")}
+	}
+	t.Currency = r.get(opts.column("currency"))
+	t.Status = r.get(opts.column("status"))
+	return t, nil
+}
+
+// importReader yields the rows of an import file; io.EOF ends it. Errors
+// other than io.EOF mean the file cannot be read any further.
+type importReader interface {
+	next() (importRow, error)
+}
+
+func newImportReader(r io.Reader, opts ImportOptions) (importReader, error) {
+	if opts.Format == ImportNDJSON {
+		return newNDJSONImportReader(r), nil
+	}
+	return newCSVImportReader(r, opts)
+}
+
+func countImportRows(opts ImportOptions) (int64, error) {
+	f, err := os.Open(opts.path())
+	if err != nil {
+		return 0, fmt.Errorf("failed opening import: %w", err)
+	}
+	defer f.Close()
+	rows, err := newImportReader(f, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for {
+		if _, err := rows.next(); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("failed reading import: %w", err)
+		}
+		n++
+	}
+}
+
+type csvImportReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+// newCSVImportReader reads the header row and checks that every required
+// field has a column.
+func newCSVImportReader(r io.Reader, opts ImportOptions) (*csvImportReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, &ValidationError{fmt.Errorf("failed reading CSV header: %w", err)}
+	}
+	cols := make([]string, len(header))
+	have := make(map[string]bool, len(header))
+	for i, h := range header {
+		cols[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		have[cols[i]] = true
+	}
+	for _, field := range importFields {
+		if field != "currency" && !have[strings.ToLower(opts.column(field))] {
+			return nil, &ValidationError{fmt.Errorf("CSV has no %q column for %s", opts.column(field), field)}
+		}
+	}
+	return &csvImportReader{r: cr, header: cols}, nil
+}
+
+func (c *csvImportReader) next() (importRow, error) {
+	record, err := c.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return importRow{line: parseErr.StartLine, err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return importRow{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	row := importRow{line: line, values: make(map[string]string, len(c.header))}
+	if len(record) != len(c.header) {
+		row.err = fmt.Errorf("row has %d fields, header has %d", len(record), len(c.header))
+	}
+	for i, v := range record {
+		if i < len(c.header) {
+			row.values[c.header[i]] = v
+		}
+	}
+
+	var raw strings.Builder
+	w := csv.NewWriter(&raw)
+	w.Write(record)
+	w.Flush()
+	row.raw = strings.TrimRight(raw.String(), "\r\n")
+	return row, nil
+}
+
+type ndjsonImportReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONImportReader(r io.Reader) *ndjsonImportReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxIngestLine)
+	return &ndjsonImportReader{s: s}
+}
+
+func (n *ndjsonImportReader) next() (importRow, error) {
+	for n.s.Scan() {
+		n.line++
+		raw := strings.TrimSpace(n.s.Text())
+		if raw == "" {
+			continue
+		}
+		row := importRow{line: n.line, raw: raw}
+
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.UseNumber()
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err != nil {
+			row.err = fmt.Errorf("invalid JSON: %v", err)
+			return row, nil
+		}
+		row.values = make(map[string]string, len(obj))
+		for k, v := range obj {
+			if v != nil {
+				row.values[strings.ToLower(k)] = fmt.Sprint(v)
+			}
+		}
+		return row, nil
+	}
+	if err := n.s.Err(); err != nil {
+		return importRow{}, err
+	}
+	return importRow{}, io.EOF
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"indico-be/internal/event"
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+)
+
+// JobService owns the lifecycle of job records of every type: it persists
+// status transitions and publishes them on the event bus.
+type JobService struct {
+	repo   repository.JobRepository
+	events *event.Bus
+	ended  []func(ctx context.Context, jobID string, status models.JobStatus)
+}
+
+func NewJobService(repo repository.JobRepository, events *event.Bus) *JobService {
+	return &JobService{repo: repo, events: events}
+}
+
+func (s *JobService) publish(e event.Event) {
+	if s.events != nil {
+		s.events.Publish(e)
+	}
+}
+
+// OnEnded registers fn to run after a job ends through Finish or CancelJob.
+// Register handlers before the service is used.
+func (s *JobService) OnEnded(fn func(ctx context.Context, jobID string, status models.JobStatus)) {
+	s.ended = append(s.ended, fn)
+}
+
+func (s *JobService) end(ctx context.Context, jobID string, status models.JobStatus) {
+	for _, fn := range s.ended {
+		fn(ctx, jobID, status)
+	}
+}
+
+// Submit stores a QUEUED job; any instance's workers may then claim it.
+func (s *JobService) Submit(ctx context.Context, job *models.Job) error {
+	if err := s.repo.Create(ctx, job); err != nil {
+		return err
+	}
+	s.Submitted(job)
+	return nil
+}
+
+// Submitted announces a QUEUED job stored by other means than Submit.
+func (s *JobService) Submitted(job *models.Job) {
+	s.publish(event.Event{JobID: job.ID, Type: event.TypeStatus, Status: string(job.Status)})
+}
+
+// SubmitClaimed stores a job that owner runs itself, already RUNNING.
+func (s *JobService) SubmitClaimed(ctx context.Context, job *models.Job, owner string, leaseUntil time.Time) error {
+	if err := s.repo.CreateClaimed(ctx, job, owner, leaseUntil); err != nil {
+		return err
+	}
+	s.publish(event.Event{JobID: job.ID, Type: event.TypeStatus, Status: string(models.JobRunning)})
+	return nil
+}
+
+// Claim takes jobID for owner until leaseUntil and announces it as RUNNING.
+func (s *JobService) Claim(ctx context.Context, jobID, owner string, leaseUntil time.Time) (bool, error) {
+	won, err := s.repo.Claim(ctx, jobID, owner, time.Now(), leaseUntil)
+	if err != nil || !won {
+		return false, err
+	}
+	s.publish(event.Event{JobID: jobID, Type: event.TypeStatus, Status: string(models.JobRunning)})
+	return true, nil
+}
+
+// Heartbeat extends owner's lease on jobID; false means it must stop.
+func (s *JobService) Heartbeat(ctx context.Context, jobID, owner string, leaseUntil time.Time) (bool, error) {
+	return s.repo.Heartbeat(ctx, jobID, owner, leaseUntil)
+}
+
+// Finish records the terminal status of a job owner still holds and
+// publishes its completion. It reports false, publishing nothing, when the
+// job was cancelled or reclaimed in the meantime.
+func (s *JobService) Finish(ctx context.Context, jobID, owner string, status models.JobStatus, resultPath string, cause error) (bool, error) {
+	var errMsg string
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+	won, err := s.repo.Finish(ctx, jobID, owner, status, resultPath, errMsg)
+	if err != nil || !won {
+		return false, err
+	}
+	e := event.Event{JobID: jobID, Type: event.TypeCompleted, Status: string(status), ResultPath: resultPath, Error: errMsg}
+	if rec, err := s.repo.GetByID(ctx, jobID); err == nil {
+		e.Processed, e.Total, e.Progress = rec.Processed, rec.Total, rec.Progress
+	}
+	s.publish(e)
+	s.end(ctx, jobID, status)
+	return true, nil
+}
+
+// Interrupt hands a job stopped by a shutdown back to the queue, to be
+// resumed by the next instance that claims it.
+func (s *JobService) Interrupt(ctx context.Context, jobID, owner string) (bool, error) {
+	won, err := s.repo.Interrupt(ctx, jobID, owner)
+	if err != nil || !won {
+		return false, err
+	}
+	s.publish(event.Event{JobID: jobID, Type: event.TypeStatus, Status: string(models.JobInterrupted)})
+	return true, nil
+}
+
+// Retry hands a job that failed back to the queue, to be claimed again
+// after retryAt and resumed from whatever the failed run saved.
+func (s *JobService) Retry(ctx context.Context, jobID, owner string, retryAt time.Time, cause error) (bool, error) {
+	won, err := s.repo.Retry(ctx, jobID, owner, retryAt, cause.Error())
+	if err != nil || !won {
+		return false, err
+	}
+	s.publish(event.Event{JobID: jobID, Type: event.TypeStatus, Status: string(models.JobInterrupted), Error: cause.Error()})
+	return true, nil
+}
+
+// CancelJob marks a job cancelled and tells its subscribers.
+func (s *JobService) CancelJob(ctx context.Context, jobID string) error {
+	if err := s.repo.MarkCancelled(ctx, jobID); err != nil {
+		return err
+	}
+	s.publish(event.Event{JobID: jobID, Type: event.TypeCompleted, Status: string(models.JobCanceled)})
+	s.end(ctx, jobID, models.JobCanceled)
+	return nil
+}
+
+func (s *JobService) UpdateTotal(ctx context.Context, jobID string, total int64) error {
+	return s.repo.UpdateTotal(ctx, jobID, total)
+}
+
+// tracker returns a progress tracker for one run of jobID through phases.
+func (s *JobService) tracker(jobID string, phases []phase) *progressTracker {
+	return newProgressTracker(jobID, s.repo, s.publish, phases)
+}
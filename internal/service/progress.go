@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"indico-be/internal/event"
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+)
+
+const (
+	PhaseCounting    = "counting"
+	PhaseAggregating = "aggregating"
+	PhaseWriting     = "writing"
+	PhaseExporting   = "exporting"
+	PhaseReconciling = "reconciling"
+	PhaseImporting   = "importing"
+)
+
+// phase is one step of a job and its share of the overall 0–100 progress.
+// Units done in a counted phase also count towards Processed.
+type phase struct {
+	name    string
+	weight  float64
+	counted bool
+}
+
+// settlementPhases weights a settlement run. Reading and aggregating
+// transactions dominates it.
+var settlementPhases = []phase{
+	{PhaseCounting, 5, false},
+	{PhaseAggregating, 70, true},
+	{PhaseWriting, 15, false},
+	{PhaseExporting, 5, false},
+	{PhaseReconciling, 5, false},
+}
+
+// importPhases weights a transaction import: a quick count of the file's
+// rows, then parsing and inserting them.
+var importPhases = []phase{
+	{PhaseCounting, 5, false},
+	{PhaseImporting, 95, true},
+}
+
+// progressTracker turns per-phase work counts into cumulative, monotonic job
+// progress. Writes to the job record are throttled to one per dbInterval
+// (plus one per phase change); events are published at most every
+// eventInterval.
+type progressTracker struct {
+	mu sync.Mutex
+
+	jobID   string
+	repo    repository.JobRepository
+	publish func(event.Event)
+	phases  []phase
+
+	dbInterval    time.Duration
+	eventInterval time.Duration
+
+	startedAt   time.Time
+	phase       int
+	phaseTotal  int64
+	phaseDone   int64
+	processed   int64
+	total       int64
+	percent     float64
+	lastDB      time.Time
+	lastEvent   time.Time
+	lastWritten int
+}
+
+func newProgressTracker(jobID string, repo repository.JobRepository, publish func(event.Event), phases []phase) *progressTracker {
+	return &progressTracker{
+		jobID:         jobID,
+		repo:          repo,
+		publish:       publish,
+		phases:        phases,
+		dbInterval:    2 * time.Second,
+		eventInterval: 250 * time.Millisecond,
+		startedAt:     time.Now(),
+		phase:         -1,
+		lastWritten:   -1,
+	}
+}
+
+// Start enters phase with `units` pieces of work. Phases only move forward.
+func (p *progressTracker) Start(ctx context.Context, phase string, units int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, ph := range p.phases {
+		if ph.name == phase && i > p.phase {
+			p.phase = i
+			p.phaseTotal = units
+			p.phaseDone = 0
+			break
+		}
+	}
+	p.recompute()
+	p.flush(ctx, true)
+}
+
+// SetTotal records how many transactions the run will process.
+func (p *progressTracker) SetTotal(total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+}
+
+// Advance marks n more units of the current phase done. In a counted phase
+// (aggregation, import) the units are transactions and also count towards
+// Processed.
+func (p *progressTracker) Advance(ctx context.Context, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.phaseDone += n
+	if p.phaseDone > p.phaseTotal {
+		p.phaseDone = p.phaseTotal
+	}
+	if p.phase >= 0 && p.phases[p.phase].counted {
+		p.processed += n
+	}
+	p.recompute()
+	p.flush(ctx, false)
+}
+
+// Complete pins progress at 100%.
+func (p *progressTracker) Complete(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.phase = len(p.phases) - 1
+	p.phaseTotal, p.phaseDone = 0, 0
+	p.percent = 100
+	p.flush(ctx, true)
+}
+
+func (p *progressTracker) recompute() {
+	var pct float64
+	for i := 0; i < p.phase; i++ {
+		pct += p.phases[i].weight
+	}
+	if p.phase >= 0 {
+		frac := 1.0
+		if p.phaseTotal > 0 {
+			frac = float64(p.phaseDone) / float64(p.phaseTotal)
+		}
+		pct += p.phases[p.phase].weight * frac
+	}
+	if pct > p.percent {
+		p.percent = pct
+	}
+}
+
+// eta extrapolates the observed rate of progress over the remaining share.
+func (p *progressTracker) eta() int64 {
+	if p.percent <= 0 || p.percent >= 100 {
+		return 0
+	}
+	elapsed := time.Since(p.startedAt).Seconds()
+	return int64(elapsed * (100 - p.percent) / p.percent)
+}
+
+func (p *progressTracker) phaseName() string {
+	if p.phase < 0 {
+		return ""
+	}
+	return p.phases[p.phase].name
+}
+
+// flush writes and publishes the snapshot if its interval has passed or
+// force is set. Callers hold p.mu.
+func (p *progressTracker) flush(ctx context.Context, force bool) {
+	now := time.Now()
+	percent := int(p.percent)
+	snap := repository.Progress{
+		Processed:  p.processed,
+		Progress:   percent,
+		Phase:      p.phaseName(),
+		EtaSeconds: p.eta(),
+	}
+
+	if p.publish != nil && (force || now.Sub(p.lastEvent) >= p.eventInterval) {
+		p.lastEvent = now
+		p.publish(event.Event{
+			JobID:      p.jobID,
+			Type:       event.TypeProgress,
+			Status:     string(models.JobRunning),
+			Phase:      snap.Phase,
+			Processed:  snap.Processed,
+			Total:      p.total,
+			Progress:   percent,
+			EtaSeconds: snap.EtaSeconds,
+		})
+	}
+
+	if force || (now.Sub(p.lastDB) >= p.dbInterval && percent != p.lastWritten) {
+		p.lastDB = now
+		p.lastWritten = percent
+		if err := p.repo.UpdateProgress(ctx, p.jobID, snap); err != nil {
+			log.Printf("[Job %s] failed updating progress: %v", p.jobID, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+)
+
+type ReconciliationService struct {
+	txRepo  repository.TransactionRepository
+	setRepo repository.SettlementRepository
+	recRepo repository.ReconciliationRepository
+}
+
+func NewReconciliationService(tx repository.TransactionRepository,
+	set repository.SettlementRepository,
+	rec repository.ReconciliationRepository) *ReconciliationService {
+
+	return &ReconciliationService{
+		txRepo:  tx,
+		setRepo: set,
+		recRepo: rec,
+	}
+}
+
+type dayKey struct {
+	merchantID uint64
+	date       string
+	currency   string
+}
+
+// Reconcile compares the transaction totals of [from, to] against the
+// current settlement versions of the period and stores every mismatching
+// merchant/day under jobID. It returns the discrepancies found.
+func (s *ReconciliationService) Reconcile(ctx context.Context, jobID string, from, to time.Time) ([]models.Reconciliation, error) {
+	expected, err := s.txRepo.DailyTotals(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading transaction totals: %w", err)
+	}
+	settled, err := s.setRepo.DailyTotals(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading settlement totals: %w", err)
+	}
+
+	rows := make(map[dayKey]*models.Reconciliation)
+	var keys []dayKey
+	get := func(t models.DailyTotal) *models.Reconciliation {
+		k := dayKey{merchantID: t.MerchantID, date: t.Date.Format("2006-01-02"), currency: t.Currency}
+		if r, ok := rows[k]; ok {
+			return r
+		}
+		r := &models.Reconciliation{
+			JobID:      jobID,
+			MerchantID: t.MerchantID,
+			Date:       t.Date,
+			Currency:   t.Currency,
+		}
+		rows[k] = r
+		keys = append(keys, k)
+		return r
+	}
+
+	for _, t := range expected {
+		r := get(t)
+		r.ExpectedCount += t.TxnCount
+		r.ExpectedGrossCents += t.GrossCents
+		r.ExpectedFeeCents += t.FeeCents
+	}
+	for _, t := range settled {
+		r := get(t)
+		r.SettledCount += t.TxnCount
+		r.SettledGrossCents += t.GrossCents
+		r.SettledFeeCents += t.FeeCents
+	}
+
+	now := time.Now()
+	var discrepancies []models.Reconciliation
+	for _, k := range keys {
+		r := rows[k]
+		if r.ExpectedCount == r.SettledCount &&
+			r.ExpectedGrossCents == r.SettledGrossCents &&
+			r.ExpectedFeeCents == r.SettledFeeCents {
+			continue
+		}
+		r.CreatedAt = now
+		discrepancies = append(discrepancies, *r)
+	}
+
+	if err := s.recRepo.ReplaceForJob(ctx, jobID, discrepancies); err != nil {
+		return nil, fmt.Errorf("failed storing reconciliation: %w", err)
+	}
+
+	log.Printf("[Job %s] reconciliation done: %d merchant-day-currencies checked, %d discrepancies", jobID, len(keys), len(discrepancies))
+	return discrepancies, nil
+}
+
+func (s *ReconciliationService) List(ctx context.Context, jobID string) ([]models.Reconciliation, error) {
+	return s.recRepo.ListByJob(ctx, jobID)
+}
+
+// RunJob reconciles [fromStr, toStr] as a standalone job and returns the
+// terminal status: FINISHED_WITH_WARNINGS when anything mismatches.
+func (s *ReconciliationService) RunJob(ctx context.Context, jobID, fromStr, toStr string) (models.JobStatus, error) {
+	from, to, err := parsePeriod(fromStr, toStr)
+	if err != nil {
+		return "", err
+	}
+	discrepancies, err := s.Reconcile(ctx, jobID, from, to)
+	if err != nil {
+		return "", err
+	}
+	if len(discrepancies) > 0 {
+		return models.JobFinishedWithWarnings, nil
+	}
+	return models.JobFinished, nil
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+
+	"github.com/robfig/cron/v3"
+)
+
+type ScheduleService struct {
+	repo repository.ScheduleRepository
+}
+
+func NewScheduleService(r repository.ScheduleRepository) *ScheduleService {
+	return &ScheduleService{repo: r}
+}
+
+// NextRun returns the first time after `after` at which the schedule fires,
+// evaluated in the schedule's timezone.
+func (s *ScheduleService) NextRun(sch *models.Schedule, after time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(sch.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q: %w", sch.Timezone, err)
+	}
+	spec, err := cron.ParseStandard(sch.CronExpr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q: %w", sch.CronExpr, err)
+	}
+	return spec.Next(after.In(loc)), nil
+}
+
+// Window returns the settlement period for a tick, e.g. the day before the
+// tick's local date for FromOffsetDays = ToOffsetDays = -1.
+func (s *ScheduleService) Window(sch *models.Schedule, tick time.Time) (from, to string, err error) {
+	loc, err := time.LoadLocation(sch.Timezone)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid timezone %q: %w", sch.Timezone, err)
+	}
+	local := tick.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	from = day.AddDate(0, 0, sch.FromOffsetDays).Format("2006-01-02")
+	to = day.AddDate(0, 0, sch.ToOffsetDays).Format("2006-01-02")
+	return from, to, nil
+}
+
+// RunOptions returns the options every job of the schedule runs with.
+func (s *ScheduleService) RunOptions(sch *models.Schedule) RunOptions {
+	return RunOptions{ConvertCurrency: sch.ConvertCurrency, Mode: sch.Mode}
+}
+
+func (s *ScheduleService) validate(sch *models.Schedule) error {
+	if sch.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if sch.Timezone == "" {
+		sch.Timezone = "Asia/Jakarta"
+	}
+	opts := s.RunOptions(sch)
+	if err := opts.Normalize(); err != nil {
+		return err
+	}
+	sch.Mode = opts.Mode
+	if sch.FromOffsetDays > sch.ToOffsetDays {
+		return fmt.Errorf("from_offset_days must not be after to_offset_days")
+	}
+	next, err := s.NextRun(sch, time.Now())
+	if err != nil {
+		return err
+	}
+	sch.NextRunAt = next
+	return nil
+}
+
+func (s *ScheduleService) Create(ctx context.Context, sch *models.Schedule) error {
+	if err := s.validate(sch); err != nil {
+		return &ValidationError{Err: err}
+	}
+	return s.repo.Create(ctx, sch)
+}
+
+func (s *ScheduleService) Update(ctx context.Context, sch *models.Schedule) error {
+	if err := s.validate(sch); err != nil {
+		return &ValidationError{Err: err}
+	}
+	return s.repo.Update(ctx, sch)
+}
+
+func (s *ScheduleService) Delete(ctx context.Context, id uint64) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *ScheduleService) Get(ctx context.Context, id uint64) (*models.Schedule, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *ScheduleService) List(ctx context.Context) ([]models.Schedule, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *ScheduleService) ListDue(ctx context.Context, now time.Time) ([]models.Schedule, error) {
+	return s.repo.ListDue(ctx, now)
+}
+
+// Claim advances a due schedule past now and stores job, the settlement
+// job of its tick, in one transaction. It returns false when another
+// replica already took this tick.
+func (s *ScheduleService) Claim(ctx context.Context, sch *models.Schedule, now time.Time, job *models.Job) (bool, error) {
+	next, err := s.NextRun(sch, now)
+	if err != nil {
+		return false, err
+	}
+	return s.repo.ClaimTick(ctx, sch.ID, sch.NextRunAt, next, job)
+}
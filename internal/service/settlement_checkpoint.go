@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"indico-be/internal/currency"
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+)
+
+// exportCheckpointRows is how many CSV rows are written between export
+// checkpoints.
+const exportCheckpointRows = 1000
+
+// shard is one slice of a run's period, read with its own keyset cursor.
+type shard struct {
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Cursor repository.Cursor `json:"cursor"`
+	Done   bool              `json:"done"`
+}
+
+// runState is a settlement run's progress as it is checkpointed. Shards
+// update it concurrently under mu; saveMu keeps checkpoints in order and
+// guards savedAt.
+type runState struct {
+	mu         sync.Mutex
+	saveMu     sync.Mutex
+	savedAt    time.Time
+	jobID      string
+	stage      string
+	start      repository.Cursor
+	cursor     repository.Cursor
+	shards     []*shard
+	total      int64
+	processed  int64
+	aggregates map[dayKey]*models.Settlement
+	// order keeps aggregates in first-seen order.
+	order        []*models.Settlement
+	exportRows   int64
+	exportOffset int64
+}
+
+func newRunState(jobID string) *runState {
+	return &runState{jobID: jobID, stage: models.CheckpointAggregating, aggregates: make(map[dayKey]*models.Settlement)}
+}
+
+// planShards splits [from, to] into up to n runs of whole days. A run that
+// starts from a watermark reads a single shard from there.
+func planShards(from, to time.Time, start repository.Cursor, n int) []*shard {
+	days := int(to.Sub(from).Hours()/24) + 1
+	if n <= 1 || days < 2 || !start.IsZero() {
+		return []*shard{{From: from, To: to, Cursor: start}}
+	}
+	if n > days {
+		n = days
+	}
+	per := (days + n - 1) / n
+	var out []*shard
+	for d := 0; d < days; d += per {
+		sh := &shard{From: from.AddDate(0, 0, d), To: from.AddDate(0, 0, d+per).Add(-time.Microsecond)}
+		if sh.To.After(to) {
+			sh.To = to
+		}
+		out = append(out, sh)
+	}
+	return out
+}
+
+// addBatch folds a shard's batch into the run and moves the shard's cursor
+// past it.
+func (st *runState) addBatch(sh *shard, batch []repository.Transaction) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, tx := range batch {
+		cur := tx.Currency
+		if cur == "" {
+			cur = currency.Default
+		}
+		st.add(tx.Transaction, cur)
+	}
+	last := batch[len(batch)-1]
+	sh.Cursor = repository.Cursor{PaidAt: last.PaidAt, ID: last.ID}
+	if sh.Cursor.After(st.cursor) {
+		st.cursor = sh.Cursor
+	}
+	st.processed += int64(len(batch))
+}
+
+func (st *runState) finishShard(sh *shard) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sh.Done = true
+}
+
+// sortAggregates fixes the order of the merged aggregates, whichever shard
+// finished first.
+func (st *runState) sortAggregates() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sortSettlements(st.order)
+}
+
+// add folds one transaction into its merchant/day/currency aggregate.
+// Callers hold st.mu.
+func (st *runState) add(tx models.Transaction, cur string) {
+	day := time.Date(tx.PaidAt.Year(), tx.PaidAt.Month(), tx.PaidAt.Day(), 0, 0, 0, 0, tx.PaidAt.Location())
+	k := dayKey{merchantID: tx.MerchantID, date: day.Format("2006-01-02"), currency: cur}
+	agg, ok := st.aggregates[k]
+	if !ok {
+		agg = &models.Settlement{
+			MerchantID: tx.MerchantID,
+			Date:       day,
+			Currency:   cur,
+			RunID:      st.jobID,
+		}
+		st.aggregates[k] = agg
+		st.order = append(st.order, agg)
+	}
+	agg.GrossCents += tx.AmountCents
+	agg.FeeCents += tx.FeeCents
+	agg.NetCents += tx.AmountCents - tx.FeeCents
+	agg.TxnCount++
+}
+
+func cursorTime(c repository.Cursor) *time.Time {
+	if c.IsZero() {
+		return nil
+	}
+	t := c.PaidAt
+	return &t
+}
+
+func cursorFrom(t *time.Time, id uint64) repository.Cursor {
+	if t == nil {
+		return repository.Cursor{}
+	}
+	return repository.Cursor{PaidAt: *t, ID: id}
+}
+
+// checkpoint snapshots the run as it would be at stage. Only the copy is
+// taken under mu; shards keep adding batches while it is encoded.
+func (st *runState) checkpoint(stage string) (*models.SettlementCheckpoint, error) {
+	st.mu.Lock()
+	shards := make([]shard, len(st.shards))
+	for i, sh := range st.shards {
+		shards[i] = *sh
+	}
+	cp := &models.SettlementCheckpoint{
+		JobID:        st.jobID,
+		Stage:        stage,
+		StartPaidAt:  cursorTime(st.start),
+		StartTxnID:   st.start.ID,
+		CursorPaidAt: cursorTime(st.cursor),
+		CursorTxnID:  st.cursor.ID,
+		Total:        st.total,
+		Processed:    st.processed,
+		ExportRows:   st.exportRows,
+		ExportOffset: st.exportOffset,
+	}
+	// Once written, the settlements table holds the aggregates.
+	var rows []models.Settlement
+	if stage == models.CheckpointAggregating {
+		rows = make([]models.Settlement, len(st.order))
+		for i, agg := range st.order {
+			rows[i] = *agg
+		}
+	}
+	st.mu.Unlock()
+
+	b, err := json.Marshal(shards)
+	if err != nil {
+		return nil, err
+	}
+	cp.Shards = string(b)
+	if rows != nil {
+		b, err := json.Marshal(rows)
+		if err != nil {
+			return nil, err
+		}
+		cp.Aggregates = string(b)
+	}
+	return cp, nil
+}
+
+// restoreRunState rebuilds a run from its checkpoint.
+func restoreRunState(cp *models.SettlementCheckpoint) (*runState, error) {
+	st := newRunState(cp.JobID)
+	st.stage = cp.Stage
+	st.start = cursorFrom(cp.StartPaidAt, cp.StartTxnID)
+	st.cursor = cursorFrom(cp.CursorPaidAt, cp.CursorTxnID)
+	st.total = cp.Total
+	st.processed = cp.Processed
+	st.exportRows = cp.ExportRows
+	st.exportOffset = cp.ExportOffset
+	if cp.Shards != "" {
+		if err := json.Unmarshal([]byte(cp.Shards), &st.shards); err != nil {
+			return nil, fmt.Errorf("failed decoding checkpointed shards: %w", err)
+		}
+	}
+
+	if cp.Stage == models.CheckpointAggregating && cp.Aggregates != "" {
+		var rows []models.Settlement
+		if err := json.Unmarshal([]byte(cp.Aggregates), &rows); err != nil {
+			return nil, fmt.Errorf("failed decoding checkpointed aggregates: %w", err)
+		}
+		for i := range rows {
+			agg := &rows[i]
+			k := dayKey{merchantID: agg.MerchantID, date: agg.Date.Format("2006-01-02"), currency: agg.Currency}
+			st.aggregates[k] = agg
+			st.order = append(st.order, agg)
+		}
+	}
+	return st, nil
+}
+
+// saveCheckpoint persists the run's checkpoint at stage through repo, which
+// may be bound to the transaction that writes the settlements.
+func (s *SettlementService) saveCheckpoint(ctx context.Context, repo repository.SettlementRepository, st *runState, stage string) error {
+	// Shards save concurrently; snapshot and write under one lock so an
+	// older snapshot never lands after a newer one.
+	st.saveMu.Lock()
+	defer st.saveMu.Unlock()
+	return s.writeCheckpoint(ctx, repo, st, stage)
+}
+
+// checkpointDue saves the aggregating checkpoint once the last save is
+// s.checkpointEvery old. The aggregates grow with the period, so encoding
+// them after every batch would cost more than the batches a crash makes a
+// run read again. A shard that finds another one saving carries on; the
+// next save includes its batch.
+func (s *SettlementService) checkpointDue(ctx context.Context, st *runState) error {
+	if !st.saveMu.TryLock() {
+		return nil
+	}
+	defer st.saveMu.Unlock()
+	if time.Since(st.savedAt) < s.checkpointEvery {
+		return nil
+	}
+	return s.writeCheckpoint(ctx, s.setRepo, st, models.CheckpointAggregating)
+}
+
+// writeCheckpoint does the save; callers hold st.saveMu.
+func (s *SettlementService) writeCheckpoint(ctx context.Context, repo repository.SettlementRepository, st *runState, stage string) error {
+	cp, err := st.checkpoint(stage)
+	if err != nil {
+		return err
+	}
+	if err := repo.SaveCheckpoint(ctx, cp); err != nil {
+		return fmt.Errorf("failed saving checkpoint: %w", err)
+	}
+	st.savedAt = time.Now()
+	return nil
+}
+
+// stopAt checkpoints a run that is being stopped between batches. The job's
+// context is already done, so the write gets its own. A job stopped because
+// it was cancelled never resumes, so its checkpoint is dropped instead.
+func (s *SettlementService) stopAt(st *runState, cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.saveCheckpoint(ctx, s.setRepo, st, st.stage); err != nil {
+		log.Printf("[Job %s] %v", st.jobID, err)
+		return cause
+	}
+	// Checked after saving: a cancel that lands in between has already
+	// dropped the checkpoint through jobEnded.
+	if rec, err := s.jobs.repo.GetByID(ctx, st.jobID); err == nil && rec.Status.IsTerminal() {
+		s.jobEnded(ctx, st.jobID, rec.Status)
+		return cause
+	}
+	log.Printf("[Job %s] checkpointed after %d processed", st.jobID, st.processed)
+	return cause
+}
+
+// jobEnded drops the checkpoint of a job that ended without finishing; it
+// will never be resumed.
+func (s *SettlementService) jobEnded(ctx context.Context, jobID string, status models.JobStatus) {
+	if status != models.JobCanceled && status != models.JobFailed {
+		return
+	}
+	if err := s.setRepo.DeleteCheckpoint(ctx, jobID); err != nil {
+		log.Printf("[Job %s] failed deleting checkpoint: %v", jobID, err)
+	}
+}
+
+// sortSettlements gives exports a stable row order, so a resumed export
+// continues exactly where the previous one stopped.
+func sortSettlements(rows []*models.Settlement) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.MerchantID != b.MerchantID {
+			return a.MerchantID < b.MerchantID
+		}
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.Currency < b.Currency
+	})
+}
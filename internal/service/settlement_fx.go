@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"indico-be/internal/currency"
+	"indico-be/internal/models"
+)
+
+type rateKey struct {
+	base, quote string
+	date        string
+}
+
+// convertCurrencies is the optional FX stage of a run. Every aggregate whose
+// merchant settles in another currency gets its Settled* amounts filled with
+// the rate effective on the settlement date; merchants without a configured
+// currency settle in the currency they were paid in.
+func (s *SettlementService) convertCurrencies(ctx context.Context, settlements []*models.Settlement) error {
+	targets, err := s.fxRepo.SettlementCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+
+	rates := make(map[rateKey]*big.Rat)
+	rateStr := make(map[rateKey]string)
+	for _, st := range settlements {
+		target := targets[st.MerchantID]
+		if target == "" || target == st.Currency {
+			st.SettlementCurrency = st.Currency
+			st.FxRate = "1"
+			st.SettledGrossCents = st.GrossCents
+			st.SettledFeeCents = st.FeeCents
+			st.SettledNetCents = st.NetCents
+			continue
+		}
+
+		k := rateKey{base: st.Currency, quote: target, date: st.Date.Format("2006-01-02")}
+		rate, ok := rates[k]
+		if !ok {
+			// A rate is effective for the whole settlement day.
+			endOfDay := st.Date.Add(24*time.Hour - time.Nanosecond)
+			fx, err := s.fxRepo.RateAt(ctx, st.Currency, target, endOfDay)
+			if err != nil {
+				return err
+			}
+			if rate, err = currency.ParseRate(fx.Rate); err != nil {
+				return err
+			}
+			rates[k] = rate
+			rateStr[k] = fx.Rate
+		}
+
+		gross, err := currency.Convert(st.GrossCents, st.Currency, target, rate)
+		if err != nil {
+			return err
+		}
+		fee, err := currency.Convert(st.FeeCents, st.Currency, target, rate)
+		if err != nil {
+			return err
+		}
+
+		st.SettlementCurrency = target
+		st.FxRate = rateStr[k]
+		st.SettledGrossCents = gross
+		st.SettledFeeCents = fee
+		// Net is derived so that gross = fee + net still holds after rounding.
+		st.SettledNetCents = gross - fee
+	}
+	return nil
+}
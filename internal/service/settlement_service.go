@@ -3,151 +3,684 @@ package service
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"indico-be/internal/currency"
 	"indico-be/internal/models"
 	"indico-be/internal/repository"
 )
 
+const (
+	// ModeFull rescans the whole period and is authoritative for it.
+	ModeFull = "full"
+	// ModeIncremental only reads transactions past the stream's watermark
+	// and merges them into the current day aggregates.
+	ModeIncremental = "incremental"
+
+	DefaultStream = "default"
+)
+
+// RunOptions tweaks a single settlement run.
+type RunOptions struct {
+	// ConvertCurrency converts every aggregate into the merchant's
+	// settlement currency using the rate effective on the settlement date.
+	ConvertCurrency bool   `json:"convert_currency"`
+	Mode            string `json:"mode,omitempty"`
+	Stream          string `json:"stream,omitempty"`
+}
+
+// Normalize fills defaults and rejects unknown modes.
+func (o *RunOptions) Normalize() error {
+	if o.Mode == "" {
+		o.Mode = ModeFull
+	}
+	if o.Mode != ModeFull && o.Mode != ModeIncremental {
+		return &ValidationError{Err: fmt.Errorf("unknown mode %q", o.Mode)}
+	}
+	if o.Stream == "" {
+		o.Stream = DefaultStream
+	}
+	return nil
+}
+
+// parsePeriod parses an inclusive [from, to] date range in the configured
+// timezone (see models.ParseDate); to is moved to the end of its day so
+// transactions paid on the last day are included.
+func parsePeriod(fromStr, toStr string) (time.Time, time.Time, error) {
+	from, err := models.ParseDate(fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from date: %w", err)
+	}
+	to, err := models.ParseDate(toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to date: %w", err)
+	}
+	return from, to.AddDate(0, 0, 1).Add(-time.Microsecond), nil
+}
+
 type SettlementService struct {
-	txRepo    repository.TransactionRepository
-	setRepo   repository.SettlementRepository
-	JobRepo   repository.JobRepository
-	mu        sync.Mutex
-	batchSize int
+	txRepo      repository.TransactionRepository
+	setRepo     repository.SettlementRepository
+	jobs        *JobService
+	fxRepo      repository.FxRepository
+	recon       *ReconciliationService
+	mu          sync.Mutex
+	batchSize   int
+	parallelism int
+	writeChunk  int
+	exportDir   string
+	// checkpointEvery spaces the checkpoints taken while aggregating.
+	checkpointEvery time.Duration
+	// reports serves the read-only settlement queries of the API and
+	// exports; runs always read their own writes from setRepo.
+	reports repository.SettlementRepository
 }
 
 func NewSettlementService(tx repository.TransactionRepository,
 	set repository.SettlementRepository,
-	job repository.JobRepository) *SettlementService {
+	fx repository.FxRepository,
+	recon *ReconciliationService,
+	jobs *JobService) *SettlementService {
 
-	return &SettlementService{
-		txRepo:    tx,
-		setRepo:   set,
-		JobRepo:   job,
-		batchSize: 5000,
+	s := &SettlementService{
+		txRepo:      tx,
+		setRepo:     set,
+		reports:     set,
+		jobs:        jobs,
+		fxRepo:      fx,
+		recon:       recon,
+		batchSize:   5000,
+		parallelism: 4,
+		writeChunk:  500,
+		exportDir:   "public/downloads",
+
+		checkpointEvery: 5 * time.Second,
 	}
+	jobs.OnEnded(s.jobEnded)
+	return s
 }
 
-func (s *SettlementService) RunJob(ctx context.Context, jobID, fromStr, toStr string) error {
-	from, err := time.Parse("2006-01-02", fromStr)
-	if err != nil {
-		return fmt.Errorf("invalid from date: %w", err)
+// SetReportRepo routes settlement reports to repo, e.g. one on a replica.
+func (s *SettlementService) SetReportRepo(repo repository.SettlementRepository) {
+	s.reports = repo
+}
+
+// SetBatchSize sets how many transactions one read of a shard returns.
+func (s *SettlementService) SetBatchSize(n int) {
+	if n < 1 {
+		n = 1
 	}
-	to, err := time.Parse("2006-01-02", toStr)
+	s.batchSize = n
+}
+
+// SetExportDir sets where settlement CSVs are written.
+func (s *SettlementService) SetExportDir(dir string) {
+	s.exportDir = dir
+}
+
+// SetCheckpointInterval sets how often a run saves its position and partial
+// aggregates while reading transactions; 0 saves after every batch.
+func (s *SettlementService) SetCheckpointInterval(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	s.checkpointEvery = d
+}
+
+// SetParallelism bounds how many day shards of one settlement job are read
+// concurrently; 1 reads the period sequentially.
+func (s *SettlementService) SetParallelism(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.parallelism = n
+}
+
+// SetWriteChunk sets how many settlement rows go into one multi-row insert.
+func (s *SettlementService) SetWriteChunk(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.writeChunk = n
+}
+
+// RunJob settles [fromStr, toStr] and returns the terminal status the job
+// finished with; the caller records it. A job that was stopped part way
+// continues from its last checkpoint.
+func (s *SettlementService) RunJob(ctx context.Context, jobID, fromStr, toStr string, opts RunOptions) (models.JobStatus, error) {
+	from, to, err := parsePeriod(fromStr, toStr)
 	if err != nil {
-		return fmt.Errorf("invalid to date: %w", err)
+		return "", err
+	}
+	if err := opts.Normalize(); err != nil {
+		return "", err
 	}
+	incremental := opts.Mode == ModeIncremental
+
+	progress := s.jobs.tracker(jobID, settlementPhases)
+	progress.Start(ctx, PhaseCounting, 1)
 
-	total, err := s.txRepo.CountByPeriod(context.Background(), from, to)
+	st, err := s.resume(ctx, jobID)
 	if err != nil {
-		return fmt.Errorf("failed counting transactions: %w", err)
+		return "", err
+	}
+	if st == nil {
+		st = newRunState(jobID)
+		readTo := to
+		if incremental {
+			wm, err := s.setRepo.GetWatermark(ctx, opts.Stream)
+			if err != nil {
+				return "", fmt.Errorf("failed loading watermark: %w", err)
+			}
+			st.start = markOf(wm)
+			if readTo, err = s.incrementalEnd(ctx, opts.Stream, to); err != nil {
+				return "", err
+			}
+		}
+		st.cursor = st.start
+		st.shards = planShards(from, readTo, st.start, s.parallelism)
+		st.total, err = s.txRepo.CountAfter(ctx, from, readTo, st.start)
+		if err != nil {
+			return "", fmt.Errorf("failed counting transactions: %w", err)
+		}
 	}
-	if err := s.JobRepo.UpdateTotal(context.Background(), jobID, total); err != nil {
-		return fmt.Errorf("failed updating total: %w", err)
+	if err := s.jobs.UpdateTotal(ctx, jobID, st.total); err != nil {
+		return "", fmt.Errorf("failed updating total: %w", err)
 	}
+	progress.SetTotal(st.total)
 
 	var allSettlements []*models.Settlement
+	if st.stage == models.CheckpointAggregating {
+		progress.Start(ctx, PhaseAggregating, st.total)
+		progress.Advance(ctx, st.processed)
+		if err := s.aggregate(ctx, st, progress); err != nil {
+			return "", err
+		}
+
+		// Merging and conversion work on copies so the checkpoint keeps
+		// the raw sums if the write below is interrupted.
+		allSettlements = cloneSettlements(st.order)
+		if incremental {
+			if err := s.mergeCurrent(ctx, from, to, byDay(allSettlements)); err != nil {
+				return "", fmt.Errorf("failed merging into current settlements: %w", err)
+			}
+		}
+		if opts.ConvertCurrency {
+			if err := s.convertCurrencies(ctx, allSettlements); err != nil {
+				return "", fmt.Errorf("failed converting currencies: %w", err)
+			}
+		}
+
+		if err := s.write(ctx, from, to, opts, st, allSettlements, progress); err != nil {
+			if ctx.Err() != nil {
+				return "", s.stopAt(st, err)
+			}
+			if errors.Is(err, errWatermarkMoved) {
+				// The sums are of a range another run has settled; the
+				// next attempt starts over from the new watermark.
+				if err := s.setRepo.DeleteCheckpoint(ctx, jobID); err != nil {
+					log.Printf("[Job %s] failed deleting checkpoint: %v", jobID, err)
+				}
+			}
+			return "", err
+		}
+	} else {
+		rows, err := s.setRepo.ListByRun(ctx, jobID)
+		if err != nil {
+			return "", fmt.Errorf("failed loading written settlements: %w", err)
+		}
+		for i := range rows {
+			allSettlements = append(allSettlements, &rows[i])
+		}
+	}
+	sortSettlements(allSettlements)
+
+	if st.stage == models.CheckpointWritten {
+		progress.Start(ctx, PhaseExporting, int64(len(allSettlements)))
+		if err := s.generateCSV(ctx, jobID, allSettlements, st); err != nil {
+			return "", fmt.Errorf("failed generating CSV: %w", err)
+		}
+	}
+
+	progress.Start(ctx, PhaseReconciling, 1)
+	status := models.JobFinished
+	discrepancies, err := s.recon.Reconcile(ctx, jobID, from, to)
+	if err != nil {
+		return "", fmt.Errorf("failed reconciling settlements: %w", err)
+	}
+	if len(discrepancies) > 0 {
+		status = models.JobFinishedWithWarnings
+	}
+
+	progress.Complete(ctx)
+	if err := s.setRepo.DeleteCheckpoint(ctx, jobID); err != nil {
+		log.Printf("[Job %s] failed deleting checkpoint: %v", jobID, err)
+	}
+
+	log.Printf("[Job %s] COMPLETED (%s, %s): %d settlements written to CSV", jobID, opts.Mode, status, len(allSettlements))
+	return status, nil
+}
+
+// resume loads the job's checkpoint, or returns nil for a fresh run.
+func (s *SettlementService) resume(ctx context.Context, jobID string) (*runState, error) {
+	cp, err := s.setRepo.GetCheckpoint(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading checkpoint: %w", err)
+	}
+	if cp == nil {
+		return nil, nil
+	}
+	st, err := restoreRunState(cp)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Job %s] resuming from %s checkpoint (%d/%d processed, %d rows exported)", jobID, st.stage, st.processed, st.total, st.exportRows)
+	return st, nil
+}
+
+// aggregate reads the transactions of every unfinished shard in keyset
+// batches, up to s.parallelism shards at a time, and sums them per merchant
+// per day per currency. Shards cover whole days, so their aggregates never
+// overlap; rows are only written once every shard has been read.
+func (s *SettlementService) aggregate(ctx context.Context, st *runState, progress *progressTracker) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Whatever was saved before is as good as a fresh save.
+	st.savedAt = time.Now()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		slots    = make(chan struct{}, s.parallelism)
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for i, sh := range st.shards {
+		if sh.Done {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, sh *shard) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-runCtx.Done():
+				return
+			}
+			if err := s.aggregateShard(runCtx, st, i, sh, progress); err != nil {
+				fail(err)
+			}
+		}(i, sh)
+	}
+	wg.Wait()
+
+	// Stop when the job is cancelled or the worker shuts down: every
+	// shard has returned, so the checkpoint is consistent.
+	if ctx.Err() != nil {
+		return s.stopAt(st, ctx.Err())
+	}
+	if firstErr != nil {
+		// Every shard has returned here too: save where they got to, so a
+		// retry reads no batch twice.
+		if err := s.saveCheckpoint(ctx, s.setRepo, st, models.CheckpointAggregating); err != nil {
+			log.Printf("[Job %s] %v", st.jobID, err)
+		}
+		return firstErr
+	}
+	st.sortAggregates()
+	return nil
+}
 
-	var offset int64 = 0
+func (s *SettlementService) aggregateShard(ctx context.Context, st *runState, i int, sh *shard, progress *progressTracker) error {
+	cursor := sh.Cursor
 	for {
-		batch, err := s.txRepo.GetBatch(context.Background(), from, to, int(offset), s.batchSize)
+		// Stop between batches when the job is cancelled or the worker
+		// shuts down.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := s.txRepo.GetBatchAfter(ctx, sh.From, sh.To, cursor, s.batchSize)
 		if err != nil {
-			return fmt.Errorf("failed fetching batch: %w", err)
+			return fmt.Errorf("failed fetching batch of shard %d: %w", i, err)
 		}
 		if len(batch) == 0 {
-			break
+			st.finishShard(sh)
+			return nil
 		}
 
-		settlements := make([]*models.Settlement, 0, len(batch))
-		for _, tx := range batch {
-			settlements = append(settlements, &models.Settlement{
-				MerchantID:  tx.MerchantID,
-				Date:        tx.PaidAt,
-				GrossCents:  int64(tx.FeeCents * 100),
-				FeeCents:    int64(tx.FeeCents),
-				NetCents:    int64((tx.AmountCents - tx.FeeCents) * 100),
-				TxnCount:    1,
-				GeneratedAt: time.Now(),
-				RunID:       jobID,
-			})
+		st.addBatch(sh, batch)
+		processedBatch := int64(len(batch))
+		progress.Advance(ctx, processedBatch)
+
+		log.Printf("[Job %s] shard %d batch after %s#%d → processed %d", st.jobID, i, cursor.PaidAt.Format(time.RFC3339), cursor.ID, processedBatch)
+
+		last := batch[len(batch)-1]
+		cursor = repository.Cursor{PaidAt: last.PaidAt, ID: last.ID}
+
+		// A run that crashes reads again at most the batches of the last
+		// checkpoint interval.
+		if err := s.checkpointDue(ctx, st); err != nil {
+			return err
+		}
+	}
+}
+
+// errWatermarkMoved fails an incremental run whose stream was settled past
+// where the run started while it was reading.
+var errWatermarkMoved = errors.New("watermark moved since the run started; another run settled this stream")
+
+// markOf is where wm says the stream was settled up to.
+func markOf(wm *models.SettlementWatermark) repository.Cursor {
+	if wm == nil {
+		return repository.Cursor{}
+	}
+	return repository.Cursor{PaidAt: wm.LastPaidAt, ID: wm.LastTxnID}
+}
+
+// write stores the run's settlement versions, promotes them and advances
+// the watermark. The checkpoint moves to written in the same transaction,
+// so a resumed job never writes or counts the same transactions twice.
+func (s *SettlementService) write(ctx context.Context, from, to time.Time, opts RunOptions,
+	st *runState, settlements []*models.Settlement, progress *progressTracker) error {
+
+	incremental := opts.Mode == ModeIncremental
+	progress.Start(ctx, PhaseWriting, int64(len(settlements)))
+	generatedAt := time.Now()
+	err := s.setRepo.InTx(ctx, func(repo repository.SettlementRepository) error {
+		// Runs of one stream write one at a time. An incremental run's sums
+		// are deltas on top of its starting watermark, so they only hold
+		// while nobody has moved it.
+		wm, err := repo.LockWatermark(ctx, opts.Stream)
+		if err != nil {
+			return fmt.Errorf("failed locking watermark: %w", err)
+		}
+		if incremental && !markOf(wm).Equal(st.start) {
+			return errWatermarkMoved
 		}
 
 		for _, d := range settlements {
-			if err := s.setRepo.Upsert(ctx, d); err != nil {
-				return fmt.Errorf("failed upserting settlement (merchant_id=%d, date=%v): %w", d.MerchantID, d.Date, err)
+			d.GeneratedAt = generatedAt
+		}
+		for start := 0; start < len(settlements); start += s.writeChunk {
+			end := start + s.writeChunk
+			if end > len(settlements) {
+				end = len(settlements)
 			}
+			if err := repo.SaveVersions(ctx, settlements[start:end], s.writeChunk); err != nil {
+				return fmt.Errorf("failed saving settlements: %w", err)
+			}
+			progress.Advance(ctx, int64(end-start))
 		}
 
-		allSettlements = append(allSettlements, settlements...)
-
-		processedBatch := int64(len(batch))
-		if err := s.JobRepo.IncrementProcessed(
-			context.Background(),
-			jobID,
-			processedBatch,
-			float64(processedBatch)/float64(total)*100,
-		); err != nil {
-			return fmt.Errorf("failed updating progress: %w", err)
+		if incremental {
+			if err := repo.PromoteRunKeys(ctx, st.jobID); err != nil {
+				return fmt.Errorf("failed promoting settlement versions: %w", err)
+			}
+		} else if err := repo.PromoteRun(ctx, st.jobID, from, to); err != nil {
+			return fmt.Errorf("failed promoting settlement versions: %w", err)
 		}
 
-		log.Printf("[Job %s] batch offset %d → processed %d (total %d)", jobID, offset, processedBatch, total)
+		if err := s.moveWatermark(ctx, repo, from, opts, wm, st); err != nil {
+			return err
+		}
 
-		offset += processedBatch
+		return s.saveCheckpoint(ctx, repo, st, models.CheckpointWritten)
+	})
+	if err != nil {
+		return err
 	}
+	st.stage = models.CheckpointWritten
+	return nil
+}
 
-	if err := s.generateCSV(ctx, jobID, allSettlements); err != nil {
-		return fmt.Errorf("failed generating CSV: %w", err)
+// incrementalEnd is where an incremental run stops reading: just before the
+// stream's first span, whose transactions a full run already settled.
+func (s *SettlementService) incrementalEnd(ctx context.Context, stream string, to time.Time) (time.Time, error) {
+	spans, err := s.setRepo.ListSpans(ctx, stream)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed loading settled spans: %w", err)
+	}
+	if len(spans) > 0 && !spans[0].FromPaidAt.After(to) {
+		return spans[0].FromPaidAt.Add(-time.Microsecond), nil
 	}
+	return to, nil
+}
 
-	if err := s.JobRepo.UpdateStatus(ctx, jobID, "FINISHED"); err != nil {
-		return fmt.Errorf("failed updating job status to FINISHED: %w", err)
+// moveWatermark advances the stream's watermark past what the run read. A
+// full run that starts after the watermark, with unsettled transactions in
+// between, is recorded as a span instead: moving the watermark would skip
+// those transactions, and leaving it would make incremental runs count the
+// run's own transactions again. Spans the watermark has caught up with are
+// then jumped over.
+func (s *SettlementService) moveWatermark(ctx context.Context, repo repository.SettlementRepository, from time.Time,
+	opts RunOptions, wm *models.SettlementWatermark, st *runState) error {
+
+	mark := markOf(wm)
+	if st.cursor.After(st.start) {
+		contiguous := wm == nil || opts.Mode == ModeIncremental
+		if !contiguous {
+			var err error
+			if contiguous, err = s.settledUntil(ctx, mark, from); err != nil {
+				return err
+			}
+		}
+		if contiguous {
+			if err := repo.AdvanceWatermark(ctx, opts.Stream, st.cursor, st.jobID); err != nil {
+				return fmt.Errorf("failed advancing watermark: %w", err)
+			}
+			if st.cursor.After(mark) {
+				mark = st.cursor
+			}
+		} else if err := repo.AddSpan(ctx, &models.SettlementSpan{
+			Stream:     opts.Stream,
+			FromPaidAt: from,
+			LastPaidAt: st.cursor.PaidAt,
+			LastTxnID:  st.cursor.ID,
+			RunID:      st.jobID,
+		}); err != nil {
+			return fmt.Errorf("failed recording settled span: %w", err)
+		}
 	}
 
-	log.Printf("[Job %s] COMPLETED successfully: %d settlements written to CSV", jobID, len(allSettlements))
+	spans, err := repo.ListSpans(ctx, opts.Stream)
+	if err != nil {
+		return fmt.Errorf("failed loading settled spans: %w", err)
+	}
+	for _, sp := range spans {
+		reached, err := s.settledUntil(ctx, mark, sp.FromPaidAt)
+		if err != nil {
+			return err
+		}
+		if !reached {
+			break
+		}
+		end := repository.Cursor{PaidAt: sp.LastPaidAt, ID: sp.LastTxnID}
+		if end.After(mark) {
+			if err := repo.AdvanceWatermark(ctx, opts.Stream, end, sp.RunID); err != nil {
+				return fmt.Errorf("failed advancing watermark: %w", err)
+			}
+			mark = end
+		}
+		if err := repo.DeleteSpan(ctx, sp.ID); err != nil {
+			return fmt.Errorf("failed deleting settled span: %w", err)
+		}
+	}
 	return nil
 }
 
-func (s *SettlementService) generateCSV(ctx context.Context, jobID string, settlements []*models.Settlement) error {
-	filePath := filepath.Join("public/downloads", jobID+".csv")
+// settledUntil reports whether no transaction lies between mark and until.
+func (s *SettlementService) settledUntil(ctx context.Context, mark repository.Cursor, until time.Time) (bool, error) {
+	if !mark.PaidAt.Before(until) {
+		return true, nil
+	}
+	n, err := s.txRepo.CountAfter(ctx, mark.PaidAt, until.Add(-time.Microsecond), mark)
+	if err != nil {
+		return false, fmt.Errorf("failed checking watermark gap: %w", err)
+	}
+	return n == 0, nil
+}
+
+func cloneSettlements(rows []*models.Settlement) []*models.Settlement {
+	out := make([]*models.Settlement, len(rows))
+	for i, r := range rows {
+		c := *r
+		out[i] = &c
+	}
+	return out
+}
 
-	if err := os.MkdirAll("public/downloads", os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create public/downloads directory: %w", err)
+func byDay(rows []*models.Settlement) map[dayKey]*models.Settlement {
+	out := make(map[dayKey]*models.Settlement, len(rows))
+	for _, r := range rows {
+		out[dayKey{merchantID: r.MerchantID, date: r.Date.Format("2006-01-02"), currency: r.Currency}] = r
 	}
+	return out
+}
 
-	file, err := os.Create(filePath)
+// mergeCurrent adds the current version of every touched merchant/day to the
+// incremental deltas, so the new version holds the full day total.
+func (s *SettlementService) mergeCurrent(ctx context.Context, from, to time.Time, deltas map[dayKey]*models.Settlement) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	current, err := s.setRepo.ListCurrent(ctx, 0, from, to)
 	if err != nil {
-		return fmt.Errorf("failed to create CSV file: %w", err)
+		return err
+	}
+	for _, c := range current {
+		k := dayKey{merchantID: c.MerchantID, date: c.Date.Format("2006-01-02"), currency: c.Currency}
+		d, ok := deltas[k]
+		if !ok {
+			continue
+		}
+		d.GrossCents += c.GrossCents
+		d.FeeCents += c.FeeCents
+		d.NetCents += c.NetCents
+		d.TxnCount += c.TxnCount
+	}
+	return nil
+}
+
+// generateCSV writes the settlements to the job's CSV. With a run state it
+// resumes a partly written file and checkpoints its offset as it goes; the
+// file only carries on where it stopped if it is still on this instance.
+func (s *SettlementService) generateCSV(ctx context.Context, jobID string, settlements []*models.Settlement, st *runState) error {
+	filePath := filepath.Join(s.exportDir, jobID+".csv")
+
+	if err := os.MkdirAll(s.exportDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", s.exportDir, err)
+	}
+
+	var (
+		file *os.File
+		skip int64
+	)
+	if st != nil && st.exportRows > 0 {
+		f, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+		if err == nil {
+			if err = f.Truncate(st.exportOffset); err == nil {
+				_, err = f.Seek(st.exportOffset, io.SeekStart)
+			}
+			if err != nil {
+				f.Close()
+			}
+		}
+		if err == nil {
+			file, skip = f, st.exportRows
+			log.Printf("[Job %s] resuming CSV after %d rows", jobID, skip)
+		} else {
+			log.Printf("[Job %s] cannot resume CSV (%v), rewriting it", jobID, err)
+		}
+	}
+
+	if file == nil {
+		f, err := os.Create(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to create CSV file: %w", err)
+		}
+		file = f
 	}
 	defer file.Close()
 
 	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	if skip == 0 {
+		headers := []string{
+			"merchant_id", "date", "currency", "gross", "fee", "net", "txn_count",
+			"settlement_currency", "fx_rate", "settled_gross", "settled_fee", "settled_net",
+			"generated_at", "run_id",
+		}
+		if err := writer.Write(headers); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	}
 
-	headers := []string{"merchant_id", "date", "gross_cents", "fee_cents", "net_cents", "txn_count", "generated_at", "run_id"}
-	if err := writer.Write(headers); err != nil {
-		return fmt.Errorf("failed to write CSV header: %w", err)
+	// checkpoint flushes what was written and records where it ends.
+	checkpoint := func(rows int64, stage string) error {
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+		if st == nil {
+			return nil
+		}
+		off, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("failed to read CSV offset: %w", err)
+		}
+		st.exportRows, st.exportOffset, st.stage = rows, off, stage
+		return s.saveCheckpoint(context.Background(), s.setRepo, st, stage)
 	}
 
-	for _, s := range settlements {
+	for i := skip; i < int64(len(settlements)); i++ {
+		s := settlements[i]
 		row := []string{
 			fmt.Sprintf("%d", s.MerchantID),
 			s.Date.Format("2006-01-02"),
-			fmt.Sprintf("%d", s.GrossCents),
-			fmt.Sprintf("%d", s.FeeCents),
-			fmt.Sprintf("%d", s.NetCents),
+			s.Currency,
+			currency.Format(s.GrossCents, s.Currency),
+			currency.Format(s.FeeCents, s.Currency),
+			currency.Format(s.NetCents, s.Currency),
 			fmt.Sprintf("%d", s.TxnCount),
+			s.SettlementCurrency,
+			s.FxRate,
+			"", "", "",
 			s.GeneratedAt.Format(time.RFC3339),
 			s.RunID,
 		}
+		if s.SettlementCurrency != "" {
+			row[9] = currency.Format(s.SettledGrossCents, s.SettlementCurrency)
+			row[10] = currency.Format(s.SettledFeeCents, s.SettlementCurrency)
+			row[11] = currency.Format(s.SettledNetCents, s.SettlementCurrency)
+		}
 		if err := writer.Write(row); err != nil {
 			return fmt.Errorf("failed to write CSV row: %w", err)
 		}
+
+		if st != nil && (i+1)%exportCheckpointRows == 0 {
+			if err := checkpoint(i+1, models.CheckpointWritten); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkpoint(int64(len(settlements)), models.CheckpointExported); err != nil {
+		return err
 	}
 
 	log.Printf("CSV file generated: %s (%d records)", filePath, len(settlements))
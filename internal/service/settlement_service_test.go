@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+	"indico-be/internal/repository/repotest"
+)
+
+func newTestSettlementService(t *testing.T, txRepo *repotest.Transactions, parallelism int) (*SettlementService, *repotest.Settlements, *repotest.Jobs, *JobService) {
+	setRepo := repotest.NewSettlements()
+	jobRepo := repotest.NewJobs(models.Job{ID: "job-1", Status: models.JobRunning})
+	jobs := NewJobService(jobRepo, nil)
+	recon := NewReconciliationService(txRepo, setRepo, repotest.Reconciliations{})
+	svc := NewSettlementService(txRepo, setRepo, nil, recon, jobs)
+	svc.SetBatchSize(4)
+	svc.SetParallelism(parallelism)
+	svc.SetExportDir(t.TempDir())
+	return svc, setRepo, jobRepo, jobs
+}
+
+func TestSettlementCheckpointOfEndedJob(t *testing.T) {
+	t.Run("stopped by cancel", func(t *testing.T) {
+		txRepo := &repotest.Transactions{Txs: repotest.SettlementFixture()}
+		svc, setRepo, jobRepo, _ := newTestSettlementService(t, txRepo, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// The job is cancelled while its second batch is read; the lost
+		// lease then stops the run.
+		txRepo.OnBatch = func(call int) {
+			if call == 2 {
+				jobRepo.SetStatus("job-1", models.JobCanceled)
+				cancel()
+			}
+		}
+
+		if _, err := svc.RunJob(ctx, "job-1", "2025-01-01", "2025-01-03", RunOptions{}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+		if _, ok := setRepo.Checkpoint("job-1"); ok {
+			t.Error("checkpoint kept for a cancelled job")
+		}
+	})
+
+	t.Run("stopped by shutdown", func(t *testing.T) {
+		txRepo := &repotest.Transactions{Txs: repotest.SettlementFixture()}
+		svc, setRepo, _, _ := newTestSettlementService(t, txRepo, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		txRepo.OnBatch = func(call int) {
+			if call == 2 {
+				cancel()
+			}
+		}
+
+		if _, err := svc.RunJob(ctx, "job-1", "2025-01-01", "2025-01-03", RunOptions{}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+		if cp, ok := setRepo.Checkpoint("job-1"); !ok || cp.Processed != 8 {
+			t.Errorf("checkpoint = %+v, %v; want it kept at 8 processed for the next claim", cp, ok)
+		}
+	})
+
+	for _, end := range []models.JobStatus{models.JobCanceled, models.JobFailed, models.JobFinished} {
+		t.Run("ended "+string(end), func(t *testing.T) {
+			_, setRepo, _, jobs := newTestSettlementService(t, &repotest.Transactions{}, 1)
+			ctx := context.Background()
+			if err := setRepo.SaveCheckpoint(ctx, &models.SettlementCheckpoint{JobID: "job-1", Stage: models.CheckpointAggregating}); err != nil {
+				t.Fatal(err)
+			}
+
+			if end == models.JobCanceled {
+				if err := jobs.CancelJob(ctx, "job-1"); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				jobs.end(ctx, "job-1", end)
+			}
+
+			_, kept := setRepo.Checkpoint("job-1")
+			if want := end == models.JobFinished; kept != want {
+				t.Errorf("checkpoint kept = %v, want %v", kept, want)
+			}
+		})
+	}
+}
+
+func TestSettlementCheckpointInterval(t *testing.T) {
+	for _, tc := range []struct {
+		every time.Duration
+		want  int
+	}{
+		{0, 8}, // one per batch of 4 of the 30 transactions
+		{time.Hour, 0},
+	} {
+		t.Run(tc.every.String(), func(t *testing.T) {
+			svc, setRepo, _, _ := newTestSettlementService(t, &repotest.Transactions{Txs: repotest.SettlementFixture()}, 1)
+			svc.SetCheckpointInterval(tc.every)
+
+			if _, err := svc.RunJob(context.Background(), "job-1", "2025-01-01", "2025-01-03", RunOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := setRepo.Saves(models.CheckpointAggregating); got != tc.want {
+				t.Errorf("saved %d aggregating checkpoints, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSettlementOverlappingIncrementalRuns(t *testing.T) {
+	txs := repotest.SettlementFixture()
+	txRepo := &repotest.Transactions{Txs: txs}
+	svc, setRepo, jobRepo, _ := newTestSettlementService(t, txRepo, 1)
+	jobRepo.Put(models.Job{ID: "job-2", Status: models.JobRunning})
+	ctx := context.Background()
+	opts := RunOptions{Mode: ModeIncremental}
+
+	// job-2 settles the whole stream while job-1 reads its first batch.
+	overlapped := false
+	txRepo.OnBatch = func(int) {
+		if overlapped {
+			return
+		}
+		overlapped = true
+		if _, err := svc.RunJob(ctx, "job-2", "2025-01-01", "2025-01-03", opts); err != nil {
+			t.Errorf("job-2: %v", err)
+		}
+	}
+
+	checkCurrent := func() {
+		t.Helper()
+		var gross, count int64
+		current, _ := setRepo.ListCurrent(ctx, 0, time.Time{}, time.Now())
+		for _, s := range current {
+			gross += s.GrossCents
+			count += s.TxnCount
+		}
+		var want int64
+		for _, tx := range txs {
+			want += tx.AmountCents
+		}
+		if gross != want || count != int64(len(txs)) {
+			t.Errorf("current settlements hold %d transactions, gross %d; want %d, %d", count, gross, len(txs), want)
+		}
+	}
+
+	if _, err := svc.RunJob(ctx, "job-1", "2025-01-01", "2025-01-03", opts); !errors.Is(err, errWatermarkMoved) {
+		t.Fatalf("overlapped run: err = %v, want errWatermarkMoved", err)
+	}
+	if _, ok := setRepo.Checkpoint("job-1"); ok {
+		t.Error("checkpoint of the stale sums kept")
+	}
+	checkCurrent()
+
+	// Its retry starts from job-2's watermark and finds nothing left.
+	txRepo.Reset()
+	if _, err := svc.RunJob(ctx, "job-1", "2025-01-01", "2025-01-03", opts); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if read, _ := txRepo.Read(); read != 0 {
+		t.Errorf("retry read %d transactions, want 0", read)
+	}
+	checkCurrent()
+}
+
+func TestSettlementPeriodInConfiguredZone(t *testing.T) {
+	// main sets time.Local to the configured timezone.
+	wib := time.FixedZone("WIB", 7*60*60)
+	saved := time.Local
+	time.Local = wib
+	t.Cleanup(func() { time.Local = saved })
+
+	at := func(day, hour, min int) time.Time { return time.Date(2025, 1, day, hour, min, 0, 0, wib) }
+	var txs []repository.Transaction
+	for i, paidAt := range []time.Time{
+		at(0, 23, 50), // 31 Dec, before the period
+		at(1, 0, 30),  // still 31 Dec in UTC
+		at(2, 12, 0),
+		at(3, 23, 30), // the period's last hour
+		at(4, 0, 10),  // after the period, still 3 Jan in UTC
+	} {
+		txs = append(txs, repository.Transaction{Transaction: models.Transaction{
+			ID: uint64(i + 1), MerchantID: 1, Currency: "IDR", AmountCents: 1000, PaidAt: paidAt,
+		}})
+	}
+	svc, setRepo, _, _ := newTestSettlementService(t, &repotest.Transactions{Txs: txs}, 1)
+
+	if _, err := svc.RunJob(context.Background(), "job-1", "2025-01-01", "2025-01-03", RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantFrom, wantTo := at(1, 0, 0), at(4, 0, 0).Add(-time.Microsecond)
+	promoted := setRepo.Promoted()
+	if len(promoted) != 1 || !promoted[0][0].Equal(wantFrom) || !promoted[0][1].Equal(wantTo) {
+		t.Errorf("promoted %v, want [%v, %v]", promoted, wantFrom, wantTo)
+	}
+	var days []string
+	for _, s := range setRepo.Written() {
+		days = append(days, s.Date.Format("2006-01-02"))
+	}
+	slices.Sort(days)
+	if want := []string{"2025-01-01", "2025-01-02", "2025-01-03"}; !slices.Equal(days, want) {
+		t.Errorf("settled days %v, want %v", days, want)
+	}
+}
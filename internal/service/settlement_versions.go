@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"indico-be/internal/models"
+)
+
+func (s *SettlementService) ListCurrent(ctx context.Context, merchantID uint64, from, to time.Time) ([]models.Settlement, error) {
+	return s.reports.ListCurrent(ctx, merchantID, from, to)
+}
+
+// ExportCurrent writes the current settlement versions of [fromStr, toStr]
+// to the job's CSV without recomputing them. merchantID 0 exports everyone.
+func (s *SettlementService) ExportCurrent(ctx context.Context, jobID, fromStr, toStr string, merchantID uint64) error {
+	from, to, err := parsePeriod(fromStr, toStr)
+	if err != nil {
+		return err
+	}
+	rows, err := s.reports.ListCurrent(ctx, merchantID, from, to)
+	if err != nil {
+		return fmt.Errorf("failed loading current settlements: %w", err)
+	}
+	out := make([]*models.Settlement, len(rows))
+	for i := range rows {
+		out[i] = &rows[i]
+	}
+	return s.generateCSV(ctx, jobID, out, nil)
+}
+
+func (s *SettlementService) ListRun(ctx context.Context, runID string) ([]models.Settlement, error) {
+	return s.reports.ListByRun(ctx, runID)
+}
+
+func (s *SettlementService) ListWatermarks(ctx context.Context) ([]models.SettlementWatermark, error) {
+	return s.reports.ListWatermarks(ctx)
+}
+
+func (s *SettlementService) ListVersions(ctx context.Context, merchantID uint64, date time.Time) ([]models.Settlement, error) {
+	return s.reports.ListVersions(ctx, merchantID, date)
+}
+
+// DiffRuns compares the versions written by two runs and returns only the
+// merchant/day/currencies whose numbers differ, ordered by merchant, date
+// and currency.
+func (s *SettlementService) DiffRuns(ctx context.Context, runA, runB string) ([]models.SettlementDiff, error) {
+	a, err := s.reports.ListByRun(ctx, runA)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading run %s: %w", runA, err)
+	}
+	b, err := s.reports.ListByRun(ctx, runB)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading run %s: %w", runB, err)
+	}
+
+	diffs := make(map[dayKey]*models.SettlementDiff)
+	get := func(st models.Settlement) *models.SettlementDiff {
+		k := dayKey{merchantID: st.MerchantID, date: st.Date.Format("2006-01-02"), currency: st.Currency}
+		d, ok := diffs[k]
+		if !ok {
+			d = &models.SettlementDiff{MerchantID: st.MerchantID, Date: st.Date, Currency: st.Currency}
+			diffs[k] = d
+		}
+		return d
+	}
+	for i := range a {
+		get(a[i]).A = &a[i]
+	}
+	for i := range b {
+		get(b[i]).B = &b[i]
+	}
+
+	out := make([]models.SettlementDiff, 0, len(diffs))
+	for _, d := range diffs {
+		var before, after models.Settlement
+		if d.A != nil {
+			before = *d.A
+		}
+		if d.B != nil {
+			after = *d.B
+		}
+		d.GrossCentsDelta = after.GrossCents - before.GrossCents
+		d.FeeCentsDelta = after.FeeCents - before.FeeCents
+		d.NetCentsDelta = after.NetCents - before.NetCents
+		d.TxnCountDelta = after.TxnCount - before.TxnCount
+		if d.A != nil && d.B != nil &&
+			d.GrossCentsDelta == 0 && d.FeeCentsDelta == 0 && d.NetCentsDelta == 0 && d.TxnCountDelta == 0 {
+			continue
+		}
+		out = append(out, *d)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].MerchantID != out[j].MerchantID {
+			return out[i].MerchantID < out[j].MerchantID
+		}
+		if !out[i].Date.Equal(out[j].Date) {
+			return out[i].Date.Before(out[j].Date)
+		}
+		return out[i].Currency < out[j].Currency
+	})
+	return out, nil
+}
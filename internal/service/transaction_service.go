@@ -0,0 +1,241 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"indico-be/internal/currency"
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+)
+
+const (
+	// ingestChunk is how many NDJSON lines are validated, deduplicated and
+	// inserted together.
+	ingestChunk = 1000
+	// maxReportedRejects caps the rejects listed in an IngestResult.
+	maxReportedRejects = 100
+	// maxIngestLine bounds one NDJSON line.
+	maxIngestLine = 64 * 1024
+)
+
+var knownTxnStatuses = map[string]bool{
+	models.TxnPaid:     true,
+	models.TxnPending:  true,
+	models.TxnFailed:   true,
+	models.TxnRefunded: true,
+}
+
+// RejectedTransaction is an input row that was not stored and why. Line is
+// 1-based.
+type RejectedTransaction struct {
+	Line        int    `json:"line"`
+	ExternalRef string `json:"external_ref,omitempty"`
+	Error       string `json:"error"`
+}
+
+// IngestResult summarises one ingestion. Duplicates were already stored (or
+// repeated within the input) and were skipped. Rejects lists at most the
+// first 100 of Rejected.
+type IngestResult struct {
+	Received   int                   `json:"received"`
+	Inserted   int64                 `json:"inserted"`
+	Duplicates int64                 `json:"duplicates"`
+	Rejected   int                   `json:"rejected"`
+	Rejects    []RejectedTransaction `json:"rejects,omitempty"`
+}
+
+func (r *IngestResult) reject(line int, ref string, err error) {
+	r.Rejected++
+	if len(r.Rejects) < maxReportedRejects {
+		r.Rejects = append(r.Rejects, RejectedTransaction{Line: line, ExternalRef: ref, Error: err.Error()})
+	}
+}
+
+type TransactionService struct {
+	repo repository.TransactionRepository
+}
+
+func NewTransactionService(repo repository.TransactionRepository) *TransactionService {
+	return &TransactionService{repo: repo}
+}
+
+// ValidateTransaction checks a pushed transaction and normalizes its
+// currency and status.
+func ValidateTransaction(t *models.Transaction) error {
+	if t.ExternalRef == nil || strings.TrimSpace(*t.ExternalRef) == "" {
+		return &ValidationError{errors.New("external_ref is required")}
+	}
+	ref := strings.TrimSpace(*t.ExternalRef)
+	if len(ref) > 191 {
+		return &ValidationError{errors.New("external_ref is longer than 191 characters")}
+	}
+	t.ExternalRef = &ref
+
+	if t.MerchantID == 0 {
+		return &ValidationError{errors.New("merchant_id is required")}
+	}
+	t.Currency = strings.ToUpper(strings.TrimSpace(t.Currency))
+	if t.Currency == "" {
+		t.Currency = currency.IDR
+	}
+	if !currency.Supported(t.Currency) {
+		return &ValidationError{fmt.Errorf("unsupported currency %q", t.Currency)}
+	}
+	if t.AmountCents <= 0 {
+		return &ValidationError{errors.New("amount_cents must be positive")}
+	}
+	if t.FeeCents < 0 || t.FeeCents > t.AmountCents {
+		return &ValidationError{errors.New("fee_cents must be between 0 and amount_cents")}
+	}
+	t.Status = strings.ToLower(strings.TrimSpace(t.Status))
+	if !knownTxnStatuses[t.Status] {
+		return &ValidationError{fmt.Errorf("unknown status %q", t.Status)}
+	}
+	if t.PaidAt.IsZero() {
+		return &ValidationError{errors.New("paid_at is required")}
+	}
+	t.ID = 0
+	return nil
+}
+
+// Ingest validates txs and stores the ones not seen before. firstLine is the
+// line number of txs[0] in the caller's input, for reporting rejects.
+func (s *TransactionService) Ingest(ctx context.Context, txs []models.Transaction, firstLine int) (IngestResult, error) {
+	res := IngestResult{Received: len(txs)}
+
+	valid := make([]models.Transaction, 0, len(txs))
+	for i := range txs {
+		t := txs[i]
+		if err := ValidateTransaction(&t); err != nil {
+			ref := ""
+			if t.ExternalRef != nil {
+				ref = *t.ExternalRef
+			}
+			res.reject(firstLine+i, ref, err)
+			continue
+		}
+		valid = append(valid, t)
+	}
+
+	inserted, duplicates, err := s.store(ctx, valid)
+	res.Inserted, res.Duplicates = inserted, duplicates
+	return res, err
+}
+
+// store inserts validated transactions whose external_ref is new and
+// reports how many it inserted and how many were duplicates, either within
+// txs or of stored rows.
+func (s *TransactionService) store(ctx context.Context, txs []models.Transaction) (int64, int64, error) {
+	seen := make(map[string]bool, len(txs))
+	refs := make([]string, 0, len(txs))
+	for _, t := range txs {
+		if !seen[*t.ExternalRef] {
+			seen[*t.ExternalRef] = true
+			refs = append(refs, *t.ExternalRef)
+		}
+	}
+	existing, err := s.repo.ExistingRefs(ctx, refs)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fresh := make([]models.Transaction, 0, len(refs))
+	for _, t := range txs {
+		if seen[*t.ExternalRef] && !existing[*t.ExternalRef] {
+			fresh = append(fresh, t)
+			// Later repeats within txs are duplicates.
+			seen[*t.ExternalRef] = false
+		}
+	}
+
+	inserted, err := s.repo.BulkInsert(ctx, fresh, ingestChunk)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Rows another request stored in the meantime were skipped by the insert.
+	return inserted, int64(len(txs)) - inserted, nil
+}
+
+// IngestNDJSON ingests one JSON transaction per line, ingestChunk lines at a
+// time. Lines that do not decode are rejected like invalid ones; blank
+// lines are skipped.
+func (s *TransactionService) IngestNDJSON(ctx context.Context, r io.Reader) (IngestResult, error) {
+	var total IngestResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxIngestLine)
+
+	chunk := make([]models.Transaction, 0, ingestChunk)
+	lines := make([]int, 0, ingestChunk)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		// Ingest numbers rejects from a first line; map them back to the
+		// input lines, which skip blanks and undecodable rows.
+		res, err := s.Ingest(ctx, chunk, 0)
+		for i := range res.Rejects {
+			res.Rejects[i].Line = lines[res.Rejects[i].Line]
+		}
+		total.merge(res)
+		chunk, lines = chunk[:0], lines[:0]
+		return err
+	}
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+		var t models.Transaction
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			total.Received++
+			total.reject(line, "", &ValidationError{fmt.Errorf("invalid JSON: %v", err)})
+			continue
+		}
+		chunk = append(chunk, t)
+		lines = append(lines, line)
+		if len(chunk) == ingestChunk {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return total, &ValidationError{fmt.Errorf("reading line %d: %w", line+1, err)}
+	}
+	return total, flush()
+}
+
+func (r *IngestResult) merge(o IngestResult) {
+	r.Received += o.Received
+	r.Inserted += o.Inserted
+	r.Duplicates += o.Duplicates
+	r.Rejected += o.Rejected
+	for _, rej := range o.Rejects {
+		if len(r.Rejects) < maxReportedRejects {
+			r.Rejects = append(r.Rejects, rej)
+		}
+	}
+}
+
+// List returns one page of transactions; limit is clamped to 1..1000.
+func (s *TransactionService) List(ctx context.Context, f repository.TransactionFilter) ([]models.Transaction, error) {
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	if f.Limit > 1000 {
+		f.Limit = 1000
+	}
+	if f.Status != "" {
+		f.Status = strings.ToLower(f.Status)
+	}
+	return s.repo.List(ctx, f)
+}
@@ -0,0 +1,315 @@
+// Package webhook notifies external systems when jobs end. Deliveries are
+// built from the ended job's record: a completion event on the local bus
+// does it right away, and a sweep picks up every job that still has none,
+// whichever process ran it. A retry loop sends them with exponential
+// backoff until they succeed or run out of attempts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"indico-be/internal/event"
+	"indico-be/internal/models"
+	"indico-be/internal/repository"
+)
+
+// notifiedStatuses are the job statuses that trigger webhooks.
+var notifiedStatuses = map[string]bool{
+	"FINISHED":               true,
+	"FINISHED_WITH_WARNINGS": true,
+	"FAILED":                 true,
+	"CANCELED":               true,
+}
+
+// sweepBatch is how many unnotified jobs one sweep handles.
+const sweepBatch = 50
+
+func notifiedList() []string {
+	out := make([]string, 0, len(notifiedStatuses))
+	for s := range notifiedStatuses {
+		out = append(out, s)
+	}
+	return out
+}
+
+// Payload is the JSON body of every delivery.
+type Payload struct {
+	Event      string    `json:"event"`
+	JobID      string    `json:"job_id"`
+	Status     string    `json:"status"`
+	Processed  int64     `json:"processed"`
+	Total      int64     `json:"total"`
+	ResultPath string    `json:"result_path,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+type Dispatcher struct {
+	repo        repository.WebhookRepository
+	jobRepo     repository.JobRepository
+	bus         *event.Bus
+	client      *http.Client
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	interval    time.Duration
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func NewDispatcher(repo repository.WebhookRepository, jobRepo repository.JobRepository, bus *event.Bus) *Dispatcher {
+	return &Dispatcher{
+		repo:        repo,
+		jobRepo:     jobRepo,
+		bus:         bus,
+		client:      newClient(10 * time.Second),
+		maxAttempts: 8,
+		baseBackoff: 30 * time.Second,
+		maxBackoff:  time.Hour,
+		interval:    5 * time.Second,
+	}
+}
+
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+
+	events, unsubscribe := d.bus.SubscribeAll(256)
+
+	go func() {
+		defer close(d.done)
+		defer unsubscribe()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-events:
+				if e.Type == event.TypeCompleted && notifiedStatuses[e.Status] {
+					if err := d.enqueue(ctx, e.JobID); err != nil {
+						log.Printf("[webhook] gagal membuat delivery job %s: %v", e.JobID, err)
+					}
+					d.sendDue(ctx)
+				}
+			case <-ticker.C:
+				d.sweep(ctx)
+				d.sendDue(ctx)
+			}
+		}
+	}()
+}
+
+// Stop waits for the in-flight send to finish.
+func (d *Dispatcher) Stop() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	<-d.done
+}
+
+// sweep creates deliveries for ended jobs that have none yet: events the
+// bus dropped, a crash between Finish and enqueue, and jobs finished by
+// other processes.
+func (d *Dispatcher) sweep(ctx context.Context) {
+	ids, err := d.repo.UnnotifiedJobs(ctx, notifiedList(), sweepBatch)
+	if err != nil {
+		log.Printf("[webhook] gagal mencari job tanpa delivery: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := d.enqueue(ctx, id); err != nil {
+			log.Printf("[webhook] gagal membuat delivery job %s: %v", id, err)
+		}
+	}
+}
+
+// enqueue records one delivery per interested subscription plus the job's
+// own callback URL, and marks the job notified in the same transaction so
+// each job is handled once across all processes.
+func (d *Dispatcher) enqueue(ctx context.Context, jobID string) error {
+	rec, err := d.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	status := string(rec.Status)
+	if !notifiedStatuses[status] {
+		return nil
+	}
+	body, err := json.Marshal(Payload{
+		Event:      "job." + strings.ToLower(status),
+		JobID:      rec.ID,
+		Status:     status,
+		Processed:  rec.Processed,
+		Total:      rec.Total,
+		ResultPath: rec.ResultPath,
+		Error:      rec.Error,
+		OccurredAt: rec.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	newDelivery := func(url string, subID *uint64) models.WebhookDelivery {
+		return models.WebhookDelivery{
+			SubscriptionID: subID,
+			JobID:          rec.ID,
+			Event:          status,
+			URL:            url,
+			Payload:        string(body),
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+	}
+
+	var deliveries []models.WebhookDelivery
+	if rec.CallbackURL != "" {
+		deliveries = append(deliveries, newDelivery(rec.CallbackURL, nil))
+	}
+
+	subs, err := d.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range subs {
+		if subs[i].Active && subscribed(subs[i].Events, status) {
+			deliveries = append(deliveries, newDelivery(subs[i].URL, &subs[i].ID))
+		}
+	}
+
+	_, err = d.repo.CreateJobDeliveries(ctx, rec.ID, []string{status}, deliveries)
+	return err
+}
+
+func subscribed(events, status string) bool {
+	if strings.TrimSpace(events) == "" {
+		return true
+	}
+	for _, ev := range strings.Split(events, ",") {
+		if strings.EqualFold(strings.TrimSpace(ev), status) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	due, err := d.repo.ListDue(ctx, time.Now(), 50)
+	if err != nil {
+		log.Printf("[webhook] gagal mengambil delivery: %v", err)
+		return
+	}
+	for i := range due {
+		dl := &due[i]
+		// Hold the delivery for longer than one request can take.
+		won, err := d.repo.ClaimDelivery(ctx, dl, time.Now().Add(2*d.client.Timeout))
+		if err != nil || !won {
+			continue
+		}
+		d.attempt(ctx, dl)
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, dl *models.WebhookDelivery) {
+	dl.Attempts++
+	code, err := d.send(ctx, dl)
+	dl.ResponseCode = code
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		dl.Status = models.DeliveryDelivered
+		dl.LastError = ""
+		dl.DeliveredAt = &now
+	case dl.Attempts >= d.maxAttempts || errors.Is(err, ErrForbiddenTarget):
+		dl.Status = models.DeliveryFailed
+		dl.LastError = err.Error()
+	default:
+		dl.LastError = err.Error()
+		dl.NextAttemptAt = now.Add(d.backoff(dl.Attempts))
+	}
+
+	if err := d.repo.SaveAttempt(ctx, dl); err != nil {
+		log.Printf("[webhook] gagal menyimpan delivery %d: %v", dl.ID, err)
+	}
+	log.Printf("[webhook] delivery %d → %s attempt %d: %s", dl.ID, dl.URL, dl.Attempts, dl.Status)
+}
+
+// backoff doubles from baseBackoff per attempt, capped at maxBackoff.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	b := d.baseBackoff
+	for i := 1; i < attempt && b < d.maxBackoff; i++ {
+		b *= 2
+	}
+	if b > d.maxBackoff {
+		b = d.maxBackoff
+	}
+	return b
+}
+
+func (d *Dispatcher) secretFor(ctx context.Context, dl *models.WebhookDelivery) (string, error) {
+	if dl.SubscriptionID != nil {
+		sub, err := d.repo.GetSubscription(ctx, *dl.SubscriptionID)
+		if err != nil {
+			return "", fmt.Errorf("subscription %d: %w", *dl.SubscriptionID, err)
+		}
+		return sub.Secret, nil
+	}
+	rec, err := d.jobRepo.GetByID(ctx, dl.JobID)
+	if err != nil {
+		return "", fmt.Errorf("job %s: %w", dl.JobID, err)
+	}
+	return rec.CallbackSecret, nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, dl *models.WebhookDelivery) (int, error) {
+	// Deliveries may predate the check, or come from callback URLs
+	// submitted before it existed.
+	if err := CheckURL(dl.URL); err != nil {
+		return 0, err
+	}
+	secret, err := d.secretFor(ctx, dl)
+	if err != nil {
+		return 0, err
+	}
+
+	body := []byte(dl.Payload)
+	ts := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, dl.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(dl.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, ts, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
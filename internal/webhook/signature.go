@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+const (
+	HeaderEvent     = "X-Indico-Event"
+	HeaderDelivery  = "X-Indico-Delivery"
+	HeaderTimestamp = "X-Indico-Timestamp"
+	HeaderSignature = "X-Indico-Signature"
+)
+
+// NewSecret returns a random signing secret.
+func NewSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Sign returns the X-Indico-Signature value for a payload: the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed by the secret. Receivers should recompute it
+// and reject stale timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget rejects webhook URLs that could reach the service's own
+// network: anything but http(s), and addresses that are loopback,
+// link-local, private or unspecified.
+var ErrForbiddenTarget = errors.New("webhook target not allowed")
+
+// CheckURL reports whether raw may be called as a webhook. Host names are
+// only resolved when a delivery is sent, so the address is checked then.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForbiddenTarget, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q, want http or https", ErrForbiddenTarget, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: no host", ErrForbiddenTarget)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && forbiddenIP(ip) {
+		return fmt.Errorf("%w: address %s", ErrForbiddenTarget, ip)
+	}
+	return nil
+}
+
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
+
+// checkDial runs on every connection the client opens, after the name is
+// resolved, so a host that resolves (or is rebound, or redirects) to an
+// internal address is refused too.
+func checkDial(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+		return fmt.Errorf("%w: address %s", ErrForbiddenTarget, host)
+	}
+	return nil
+}
+
+// newClient returns the HTTP client deliveries are sent with. It ignores
+// proxy settings, which would hide the target address from checkDial.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: checkDial}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return CheckURL(req.URL.String())
+		},
+	}
+}
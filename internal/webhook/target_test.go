@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://hooks.example.com/indico": true,
+		"http://203.0.113.7:8080/cb":       true,
+		"ftp://hooks.example.com/":         false,
+		"file:///etc/passwd":               false,
+		"https:///no-host":                 false,
+		"http://127.0.0.1/":                false,
+		"http://[::1]:9000/":               false,
+		"http://10.1.2.3/":                 false,
+		"http://192.168.0.10/":             false,
+		"http://169.254.169.254/latest/":   false,
+		"http://0.0.0.0:8080/":             false,
+	} {
+		err := CheckURL(raw)
+		if ok && err != nil {
+			t.Errorf("CheckURL(%q) = %v, want allowed", raw, err)
+		}
+		if !ok && !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("CheckURL(%q) = %v, want ErrForbiddenTarget", raw, err)
+		}
+	}
+}
+
+// A host name passes CheckURL; the address it resolves to is refused when
+// the delivery connects.
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	target := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	if err := CheckURL(target); err != nil {
+		t.Fatalf("CheckURL(%q) = %v", target, err)
+	}
+	resp, err := newClient(time.Second).Post(target, "application/json", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrForbiddenTarget) {
+		t.Errorf("post to %s: %v, want ErrForbiddenTarget", target, err)
+	}
+	if called {
+		t.Error("request reached the loopback server")
+	}
+}
@@ -2,24 +2,41 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
+	_ "time/tzdata" // schedules are evaluated in IANA timezones
 
 	"indico-be/config"
 	"indico-be/internal/handler"
 	"indico-be/internal/job"
-	"indico-be/internal/repository"
-	"indico-be/internal/service"
+	"indico-be/internal/scheduler"
+	"indico-be/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
 )
 
+const usage = `usage: indico-be [-config FILE] [command] [flags]
+
+  serve      HTTP API only; jobs are enqueued for worker processes
+  worker     job workers and the settlement scheduler; HTTP serves only
+             /healthz, /livez and /readyz
+  migrate    apply, revert or inspect schema migrations
+  seed       insert generated transactions or write them as fixtures
+  settle     run one settlement synchronously and write its CSV to a path
+  config     print the effective configuration, secrets redacted
+
+Without a command the API and the workers run in one process. -config
+(or CONFIG_FILE) names a YAML or TOML file; environment variables and
+.env override it.`
+
 func main() {
 	// ---------- Load config ----------
 	if err := godotenv.Load(); err != nil {
@@ -28,68 +45,169 @@ func main() {
 		log.Println("[INFO] .env file loaded successfully")
 	}
 
-	cfg := config.Load()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file")
+	flag.Usage = func() { fmt.Fprintln(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	cmd, args := "", flag.Args()
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "help":
+		fmt.Println(usage)
+		return
+	case "config":
+		if err := runConfig(*configPath, args); err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		return
+	}
 
-	// ---------- Koneksi DB ----------
-	db, err := gorm.Open(mysql.Open(cfg.MySQLDSN), &gorm.Config{})
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("cannot connect to db: %v", err)
+		log.Fatalf("%v", err)
+	}
+	time.Local = cfg.Location()
+
+	switch cmd {
+	case "", "serve", "worker":
+		err = runServer(cfg, cmd)
+	case "migrate":
+		err = runMigrate(cfg, args)
+	case "seed":
+		err = runSeed(cfg, args)
+	case "settle":
+		err = runSettle(cfg, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		if cmd == "" {
+			cmd = "server"
+		}
+		log.Fatalf("%s: %v", cmd, err)
+	}
+}
+
+// runServer runs the long-lived roles until SIGINT/SIGTERM: the HTTP API
+// ("serve"), the job workers and scheduler ("worker"), or both ("").
+func runServer(cfg *config.Config, mode string) error {
+	withAPI := mode != "worker"
+	withWorkers := mode != "serve"
+	if withWorkers && cfg.Worker.Count == 0 {
+		return errors.New(`worker.count (WORKER_COUNT) is 0, so no job would ever run here; run "serve" for the API alone`)
 	}
 
-	// Auto-migrate model
-	if err := db.AutoMigrate(
-		&repository.Order{},
-		&repository.Transaction{},
-		&repository.Settlement{},
-		&repository.JobRecord{},
-	); err != nil {
-		log.Fatalf("migration error: %v", err)
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
 	}
 
-	// ---------- 3️⃣ Repositories ----------
-	orderRepo := repository.NewOrderRepo(db)
-	txRepo := repository.NewTransactionRepo(db)
-	settleRepo := repository.NewSettlementRepo(db)
-	jobRepo := repository.NewJobRepository(db)
+	// ---------- 6️⃣ Job System ----------
+	// The API-only role keeps a queue without workers to enqueue into.
+	workers := 0
+	if withWorkers {
+		workers = cfg.Worker.Count
+	}
+	claimCfg := job.DefaultClaimConfig()
+	jobQueue := job.NewJobQueue(a.workerPool(workers), a.jobRepo, job.DefaultQueues, cfg.Worker.TenantWeights, claimCfg)
+	log.Printf("🔧 Workers loaded: %d (instance %s)", workers, claimCfg.Owner)
+
+	// Recurring settlement runs; safe to run on every replica.
+	var sched *scheduler.Scheduler
+	if withWorkers {
+		sched = scheduler.New(a.scheduleSvc, jobQueue, 30*time.Second)
+		sched.Start()
+	}
 
-	// ---------- 4️⃣ Services ----------
-	orderSvc := service.NewOrderService(orderRepo)
-	settleSvc := service.NewSettlementService(txRepo, settleRepo, jobRepo)
+	// Webhook notifications for every ended job, whichever process ran or
+	// cancelled it.
+	dispatcher := webhook.NewDispatcher(a.webhookRepo, a.jobRepo, a.eventBus)
+	dispatcher.Start()
 
-	// ---------- 5️⃣ Job System ----------
-	workerPool := job.NewWorkerPool(cfg.WorkerCount, settleSvc)
-	jobQueue := job.NewJobQueue(workerPool)
-	jobQueue.SetRepository(jobRepo)
-	
-	log.Printf("🔧 Workers loaded: %d ", cfg.WorkerCount)
+	checks, err := a.healthChecks(jobQueue, withWorkers)
+	if err != nil {
+		return err
+	}
 
-	// ---------- 6️⃣ HTTP Router ----------
+	// ---------- 7️⃣ HTTP Router ----------
+	// The worker role serves only the health probes.
 	router := gin.Default()
-	handler.RegisterOrderRoutes(router, orderSvc)
-	handler.RegisterJobRoutes(router, jobQueue, jobRepo)
+	handler.RegisterHealthRoutes(router, checks)
+	if withAPI {
+		handler.RegisterOrderRoutes(router, a.orderSvc)
+		handler.RegisterJobRoutes(router, jobQueue, a.jobRepo, a.reconSvc, a.eventBus, cfg.Export.Dir, cfg.HTTP.AllowedOrigins)
+		handler.RegisterSettlementRoutes(router, a.settleSvc)
+		handler.RegisterTransactionRoutes(router, a.txSvc)
+		handler.RegisterImportRoutes(router, jobQueue, a.importSvc)
+		handler.RegisterFxRoutes(router, a.fxRepo)
+		handler.RegisterScheduleRoutes(router, a.scheduleSvc)
+		handler.RegisterWebhookRoutes(router, a.webhookRepo)
+		handler.RegisterAdminRoutes(router, jobQueue, cfg.AdminToken)
+	}
 
-	// ---------- 7️⃣ Server & Shutdown ----------
 	srv := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: router,
+		Addr:              fmt.Sprintf(":%d", cfg.HTTP.Port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+	stopHTTP := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
 	}
 
+	// ---------- 8️⃣ Shutdown ----------
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
 
 	go func() {
-		<-quit
-		log.Println("shutting down server...")
-
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		_ = srv.Shutdown(ctx)
-
-		jobQueue.Close()
+		defer close(stopped)
+		sig := <-quit
+		log.Printf("shutting down (%s)...", sig)
+
+		// Report not-ready first and give load balancers DrainDelay to
+		// notice, then stop taking requests and scheduling, so nothing
+		// new is enqueued while the workers drain.
+		checks.Drain()
+		if withAPI {
+			time.Sleep(cfg.HTTP.DrainDelay)
+			stopHTTP()
+		}
+		if sched != nil {
+			sched.Stop()
+		}
+
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.Worker.ShutdownTimeout)
+		defer drainCancel()
+		if err := jobQueue.Shutdown(drainCtx); err != nil {
+			log.Printf("[WARN] %v", err)
+		}
+
+		// Last, so completions of the drained jobs still get their webhooks queued.
+		dispatcher.Stop()
+		// The worker role keeps answering probes (as draining) until its
+		// jobs are done.
+		if !withAPI {
+			stopHTTP()
+		}
+		if err := a.Close(); err != nil {
+			log.Printf("[WARN] closing db: %v", err)
+		}
 	}()
 
-	log.Printf("🚀 Server listening on :%s", cfg.Port)
+	log.Printf("🚀 Server listening on %s", srv.Addr)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("listen error: %v", err)
+		return fmt.Errorf("listen error: %w", err)
 	}
+	<-stopped
+	log.Println("shutdown complete")
+	return nil
 }
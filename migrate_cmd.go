@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"indico-be/config"
+	"indico-be/internal/migrate"
+	"indico-be/migrations"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+  up [N]           apply pending migrations (all, or the next N)
+  down [N]         revert the last N applied migrations (default 1)
+  status           list migrations and whether they are applied
+  create NAME      add an empty NN_NAME.up.sql / .down.sql pair to ./migrations
+  force VERSION    mark migrations up to VERSION applied without running them`
+
+// runMigrate implements `go run . migrate ...`.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if args[0] == "create" {
+		if len(args) < 2 {
+			return errors.New("usage: migrate create NAME")
+		}
+		up, down, err := migrate.Create("migrations", args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(up)
+		fmt.Println(down)
+		return nil
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	m, err := migrate.New(sqlDB, migrations.FS)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up", "down":
+		n := 0
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+				return fmt.Errorf("invalid count %q", args[1])
+			}
+		}
+		var done []migrate.Migration
+		if args[0] == "up" {
+			done, err = m.Up(ctx, n)
+		} else {
+			done, err = m.Down(ctx, n)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("nothing to do")
+		}
+		return nil
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			state, at := "pending", ""
+			if s.Applied {
+				state, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Dirty {
+				state = "dirty"
+			}
+			fmt.Fprintf(w, "%02d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+		}
+		return w.Flush()
+
+	case "force":
+		if len(args) < 2 {
+			return errors.New("usage: migrate force VERSION")
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return m.Force(ctx, version)
+	}
+
+	return errors.New(migrateUsage)
+}
+
+// checkSchema refuses to serve against a database that is behind the
+// migrations compiled into this binary.
+func checkSchema(db *gorm.DB) error {
+	m, err := schemaMigrator(db)
+	if err != nil {
+		return err
+	}
+	return schemaCurrent(context.Background(), m)
+}
+
+func schemaMigrator(db *gorm.DB) (*migrate.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(sqlDB, migrations.FS)
+}
+
+// schemaCurrent returns an error when migrations are pending.
+func schemaCurrent(ctx context.Context, m *migrate.Migrator) error {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is %d migration(s) behind (next: %s); run `go run . migrate up`", len(pending), pending[0])
+	}
+	return nil
+}
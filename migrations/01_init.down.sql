@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS `transactions`;
+DROP TABLE IF EXISTS `settlements`;
+DROP TABLE IF EXISTS `products`;
+DROP TABLE IF EXISTS `orders`;
+DROP TABLE IF EXISTS `jobs`;
+DROP TABLE IF EXISTS `job_records`;
@@ -1,5 +1,3 @@
-CREATE DATABASE `indico` /*!40100 DEFAULT CHARACTER SET latin1 */;
-
 -- indico.job_records definition
 
 CREATE TABLE `job_records` (
@@ -41,7 +39,7 @@ CREATE TABLE `orders` (
   `created_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
   KEY `idx_product` (`product_id`)
-) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=latin1;
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
 
 -- indico.products definition
 
@@ -66,7 +64,7 @@ CREATE TABLE `settlements` (
   PRIMARY KEY (`id`),
   UNIQUE KEY `uk_merchant_date` (`merchant_id`,`date`),
   KEY `idx_merchant_date` (`merchant_id`,`date`)
-) ENGINE=InnoDB AUTO_INCREMENT=258973 DEFAULT CHARSET=latin1;
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
 
 -- indico.transactions definition
 
@@ -79,10 +77,10 @@ CREATE TABLE `transactions` (
   `paid_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
   KEY `idx_merchant_date` (`merchant_id`,`paid_at`)
-) ENGINE=InnoDB AUTO_INCREMENT=1000001 DEFAULT CHARSET=latin1;
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
 
 -- seed
 
-INSERT INTO indico.products
+INSERT INTO products
 (id, stock)
-VALUES(1, 99);
\ No newline at end of file
+VALUES(1, 99);
@@ -0,0 +1,17 @@
+-- indico.reconciliations definition
+
+CREATE TABLE `reconciliations` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `job_id` varchar(191) DEFAULT NULL,
+  `merchant_id` bigint(20) unsigned DEFAULT NULL,
+  `date` datetime(3) DEFAULT NULL,
+  `expected_count` bigint(20) DEFAULT NULL,
+  `settled_count` bigint(20) DEFAULT NULL,
+  `expected_gross_cents` bigint(20) DEFAULT NULL,
+  `settled_gross_cents` bigint(20) DEFAULT NULL,
+  `expected_fee_cents` bigint(20) DEFAULT NULL,
+  `settled_fee_cents` bigint(20) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_reconciliations_job_id` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
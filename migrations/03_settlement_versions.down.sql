@@ -0,0 +1,9 @@
+-- fails while more than one version of a merchant/day is stored; delete the
+-- non-current versions first
+ALTER TABLE `settlements`
+  DROP INDEX `idx_current`,
+  DROP INDEX `uk_merchant_date_run`,
+  ADD UNIQUE KEY `uk_merchant_date` (`merchant_id`,`date`),
+  DROP COLUMN `is_current`,
+  DROP COLUMN `version`,
+  MODIFY `run_id` longtext;
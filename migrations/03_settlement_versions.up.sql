@@ -0,0 +1,9 @@
+-- settlements are versioned per run; (merchant_id, date) is no longer unique
+
+ALTER TABLE `settlements`
+  MODIFY `run_id` varchar(191) DEFAULT NULL,
+  ADD COLUMN `version` int(11) NOT NULL DEFAULT 1,
+  ADD COLUMN `is_current` tinyint(1) NOT NULL DEFAULT 1,
+  DROP INDEX `uk_merchant_date`,
+  ADD UNIQUE KEY `uk_merchant_date_run` (`merchant_id`,`date`,`run_id`),
+  ADD KEY `idx_current` (`is_current`,`date`,`merchant_id`);
@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS `fx_rates`;
+
+DROP TABLE IF EXISTS `merchants`;
+
+ALTER TABLE `reconciliations`
+  DROP COLUMN `currency`;
+
+ALTER TABLE `settlements`
+  DROP INDEX `uk_merchant_date_run`,
+  ADD UNIQUE KEY `uk_merchant_date_run` (`merchant_id`,`date`,`run_id`),
+  DROP COLUMN `settled_net_cents`,
+  DROP COLUMN `settled_fee_cents`,
+  DROP COLUMN `settled_gross_cents`,
+  DROP COLUMN `fx_rate`,
+  DROP COLUMN `settlement_currency`,
+  DROP COLUMN `currency`;
+
+ALTER TABLE `transactions`
+  DROP COLUMN `currency`;
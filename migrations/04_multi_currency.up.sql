@@ -0,0 +1,40 @@
+-- amounts carry a currency; settlements aggregate per (merchant, day, currency)
+
+ALTER TABLE `transactions`
+  ADD COLUMN `currency` char(3) NOT NULL DEFAULT 'IDR' AFTER `merchant_id`;
+
+ALTER TABLE `settlements`
+  ADD COLUMN `currency` char(3) NOT NULL DEFAULT 'IDR' AFTER `date`,
+  ADD COLUMN `settlement_currency` char(3) DEFAULT NULL AFTER `txn_count`,
+  ADD COLUMN `fx_rate` varchar(32) DEFAULT NULL AFTER `settlement_currency`,
+  ADD COLUMN `settled_gross_cents` bigint(20) DEFAULT NULL AFTER `fx_rate`,
+  ADD COLUMN `settled_fee_cents` bigint(20) DEFAULT NULL AFTER `settled_gross_cents`,
+  ADD COLUMN `settled_net_cents` bigint(20) DEFAULT NULL AFTER `settled_fee_cents`,
+  DROP INDEX `uk_merchant_date_run`,
+  ADD UNIQUE KEY `uk_merchant_date_run` (`merchant_id`,`date`,`currency`,`run_id`);
+
+ALTER TABLE `reconciliations`
+  ADD COLUMN `currency` char(3) DEFAULT NULL AFTER `date`;
+
+-- indico.merchants definition
+
+CREATE TABLE `merchants` (
+  `id` bigint(20) unsigned NOT NULL,
+  `settlement_currency` char(3) NOT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+-- indico.fx_rates definition
+
+CREATE TABLE `fx_rates` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `base_currency` char(3) NOT NULL,
+  `quote_currency` char(3) NOT NULL,
+  `rate` decimal(24,12) NOT NULL,
+  `effective_from` datetime(3) NOT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_fx_pair_effective` (`base_currency`,`quote_currency`,`effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
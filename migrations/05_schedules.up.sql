@@ -0,0 +1,20 @@
+-- indico.schedules definition
+
+CREATE TABLE `schedules` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(191) DEFAULT NULL,
+  `cron_expr` varchar(100) NOT NULL,
+  `timezone` varchar(64) NOT NULL,
+  `from_offset_days` bigint(20) DEFAULT NULL,
+  `to_offset_days` bigint(20) DEFAULT NULL,
+  `convert_currency` tinyint(1) DEFAULT NULL,
+  `enabled` tinyint(1) DEFAULT NULL,
+  `next_run_at` datetime(3) DEFAULT NULL,
+  `last_run_at` datetime(3) DEFAULT NULL,
+  `last_job_id` varchar(191) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_schedules_name` (`name`),
+  KEY `idx_schedules_due` (`enabled`,`next_run_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
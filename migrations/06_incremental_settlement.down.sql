@@ -0,0 +1,7 @@
+ALTER TABLE `schedules`
+  DROP COLUMN `mode`;
+
+ALTER TABLE `transactions`
+  DROP KEY `idx_paid_at_id`;
+
+DROP TABLE IF EXISTS `settlement_watermarks`;
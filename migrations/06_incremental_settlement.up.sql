@@ -0,0 +1,17 @@
+-- indico.settlement_watermarks definition
+
+CREATE TABLE `settlement_watermarks` (
+  `stream` varchar(64) NOT NULL,
+  `last_paid_at` datetime(3) DEFAULT NULL,
+  `last_txn_id` bigint(20) unsigned DEFAULT NULL,
+  `run_id` varchar(191) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`stream`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+-- keyset pagination over (paid_at, id)
+ALTER TABLE `transactions`
+  ADD KEY `idx_paid_at_id` (`paid_at`,`id`);
+
+ALTER TABLE `schedules`
+  ADD COLUMN `mode` varchar(16) NOT NULL DEFAULT 'full' AFTER `convert_currency`;
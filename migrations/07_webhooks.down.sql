@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS `webhook_deliveries`;
+
+DROP TABLE IF EXISTS `webhook_subscriptions`;
+
+ALTER TABLE `job_records`
+  DROP COLUMN `callback_secret`,
+  DROP COLUMN `callback_url`;
@@ -0,0 +1,39 @@
+ALTER TABLE `job_records`
+  ADD COLUMN `callback_url` varchar(2048) DEFAULT NULL,
+  ADD COLUMN `callback_secret` varchar(128) DEFAULT NULL;
+
+-- indico.webhook_subscriptions definition
+
+CREATE TABLE `webhook_subscriptions` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `url` varchar(2048) NOT NULL,
+  `secret` varchar(128) NOT NULL,
+  `events` varchar(255) DEFAULT NULL,
+  `active` tinyint(1) NOT NULL DEFAULT '1',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+-- indico.webhook_deliveries definition
+
+CREATE TABLE `webhook_deliveries` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `subscription_id` bigint(20) unsigned DEFAULT NULL,
+  `job_id` varchar(191) DEFAULT NULL,
+  `event` varchar(64) DEFAULT NULL,
+  `url` varchar(2048) NOT NULL,
+  `payload` text,
+  `status` varchar(16) DEFAULT NULL,
+  `attempts` bigint(20) DEFAULT NULL,
+  `response_code` bigint(20) DEFAULT NULL,
+  `last_error` text,
+  `next_attempt_at` datetime(3) DEFAULT NULL,
+  `delivered_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_deliveries_subscription_id` (`subscription_id`),
+  KEY `idx_webhook_deliveries_job_id` (`job_id`),
+  KEY `idx_deliveries_due` (`status`,`next_attempt_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
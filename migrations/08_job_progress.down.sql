@@ -0,0 +1,3 @@
+ALTER TABLE `job_records`
+  DROP COLUMN `eta_seconds`,
+  DROP COLUMN `phase`;
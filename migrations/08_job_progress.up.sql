@@ -0,0 +1,3 @@
+ALTER TABLE `job_records`
+  ADD COLUMN `phase` varchar(32) DEFAULT NULL AFTER `total`,
+  ADD COLUMN `eta_seconds` bigint(20) DEFAULT NULL AFTER `phase`;
@@ -0,0 +1,3 @@
+ALTER TABLE `job_records`
+  ADD COLUMN `type` varchar(64) NOT NULL DEFAULT 'settlement' AFTER `callback_secret`,
+  ADD COLUMN `payload` json DEFAULT NULL AFTER `type`;
@@ -0,0 +1,10 @@
+ALTER TABLE `job_records`
+  DROP KEY `idx_job_lease`,
+  DROP KEY `idx_job_claim`,
+  DROP COLUMN `attempts`,
+  DROP COLUMN `heartbeat_at`,
+  DROP COLUMN `lease_until`,
+  DROP COLUMN `owner`,
+  DROP COLUMN `priority`,
+  DROP COLUMN `tenant`,
+  DROP COLUMN `queue`;
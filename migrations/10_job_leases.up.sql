@@ -0,0 +1,11 @@
+-- Jobs are stored when they are enqueued and claimed by any instance.
+ALTER TABLE `job_records`
+  ADD COLUMN `queue` varchar(64) NOT NULL DEFAULT 'default' AFTER `payload`,
+  ADD COLUMN `tenant` varchar(191) NOT NULL DEFAULT 'anonymous' AFTER `queue`,
+  ADD COLUMN `priority` int(11) NOT NULL DEFAULT 0 AFTER `tenant`,
+  ADD COLUMN `owner` varchar(191) DEFAULT NULL AFTER `priority`,
+  ADD COLUMN `lease_until` datetime(3) DEFAULT NULL AFTER `owner`,
+  ADD COLUMN `heartbeat_at` datetime(3) DEFAULT NULL AFTER `lease_until`,
+  ADD COLUMN `attempts` int(11) NOT NULL DEFAULT 0 AFTER `heartbeat_at`,
+  ADD KEY `idx_job_claim` (`status`, `queue`, `tenant`, `created_at`),
+  ADD KEY `idx_job_lease` (`status`, `lease_until`);
@@ -0,0 +1,17 @@
+-- indico.settlement_checkpoints definition
+
+CREATE TABLE `settlement_checkpoints` (
+  `job_id` varchar(191) NOT NULL,
+  `stage` varchar(32) NOT NULL,
+  `start_paid_at` datetime(3) DEFAULT NULL,
+  `start_txn_id` bigint(20) unsigned DEFAULT NULL,
+  `cursor_paid_at` datetime(3) DEFAULT NULL,
+  `cursor_txn_id` bigint(20) unsigned DEFAULT NULL,
+  `total` bigint(20) DEFAULT NULL,
+  `processed` bigint(20) DEFAULT NULL,
+  `aggregates` longtext,
+  `export_rows` bigint(20) DEFAULT NULL,
+  `export_offset` bigint(20) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
@@ -0,0 +1,2 @@
+ALTER TABLE `settlement_checkpoints`
+  DROP COLUMN `shards`;
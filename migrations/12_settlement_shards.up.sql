@@ -0,0 +1,2 @@
+ALTER TABLE `settlement_checkpoints`
+  ADD COLUMN `shards` longtext AFTER `processed`;
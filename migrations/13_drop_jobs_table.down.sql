@@ -0,0 +1,12 @@
+CREATE TABLE `jobs` (
+  `id` varchar(255) NOT NULL,
+  `status` varchar(50) DEFAULT 'QUEUED',
+  `progress` int(11) DEFAULT '0',
+  `processed` int(11) DEFAULT '0',
+  `total` int(11) DEFAULT '0',
+  `result_path` varchar(255) DEFAULT NULL,
+  `cancelled` tinyint(1) DEFAULT '0',
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
@@ -0,0 +1,2 @@
+-- jobs was never written to; job_records holds every job
+DROP TABLE IF EXISTS `jobs`;
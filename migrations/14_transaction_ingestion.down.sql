@@ -0,0 +1,4 @@
+ALTER TABLE `transactions`
+  DROP INDEX `uk_external_ref`,
+  MODIFY `status` longtext,
+  DROP COLUMN `external_ref`;
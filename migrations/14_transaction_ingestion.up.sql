@@ -0,0 +1,5 @@
+-- transactions pushed by payment processors are deduplicated on their reference
+ALTER TABLE `transactions`
+  ADD COLUMN `external_ref` varchar(191) DEFAULT NULL AFTER `id`,
+  MODIFY `status` varchar(16) DEFAULT NULL,
+  ADD UNIQUE KEY `uk_external_ref` (`external_ref`);
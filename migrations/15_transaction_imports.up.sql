@@ -0,0 +1,16 @@
+-- indico.transaction_imports definition
+
+CREATE TABLE `transaction_imports` (
+  `sha256` char(64) NOT NULL,
+  `job_id` varchar(191) DEFAULT NULL,
+  `filename` varchar(255) DEFAULT NULL,
+  `format` varchar(16) DEFAULT NULL,
+  `total_rows` bigint(20) NOT NULL DEFAULT 0,
+  `inserted` bigint(20) NOT NULL DEFAULT 0,
+  `duplicates` bigint(20) NOT NULL DEFAULT 0,
+  `rejected` bigint(20) NOT NULL DEFAULT 0,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`sha256`),
+  KEY `idx_transaction_imports_job_id` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
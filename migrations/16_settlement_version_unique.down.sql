@@ -0,0 +1,2 @@
+ALTER TABLE `settlements`
+  DROP INDEX `uk_merchant_date_version`;
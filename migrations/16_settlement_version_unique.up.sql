@@ -0,0 +1,6 @@
+-- a version number belongs to one run per merchant/day/currency. Fails if
+-- overlapping runs already wrote the same version twice; list those with
+--   SELECT merchant_id, date, currency, version FROM settlements
+--   GROUP BY merchant_id, date, currency, version HAVING COUNT(*) > 1;
+ALTER TABLE `settlements`
+  ADD UNIQUE KEY `uk_merchant_date_version` (`merchant_id`,`date`,`currency`,`version`);
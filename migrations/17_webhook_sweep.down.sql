@@ -0,0 +1,4 @@
+ALTER TABLE `job_records`
+  DROP INDEX `idx_job_unnotified`,
+  DROP COLUMN `notified_at`,
+  DROP COLUMN `error`;
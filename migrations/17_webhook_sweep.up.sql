@@ -0,0 +1,10 @@
+-- webhook deliveries are created from the job record: notified_at marks
+-- jobs whose deliveries exist, error keeps a failure's cause for the payload
+ALTER TABLE `job_records`
+  ADD COLUMN `error` text AFTER `result_path`,
+  ADD COLUMN `notified_at` datetime(3) DEFAULT NULL AFTER `attempts`,
+  ADD KEY `idx_job_unnotified` (`notified_at`, `status`);
+
+-- jobs that ended before this migration were handled by the event path
+UPDATE `job_records` SET `notified_at` = `updated_at`
+WHERE `status` IN ('FINISHED', 'FINISHED_WITH_WARNINGS', 'FAILED', 'CANCELED');
@@ -0,0 +1,14 @@
+-- indico.settlement_spans definition
+-- periods full runs settled past a watermark they did not start from
+
+CREATE TABLE `settlement_spans` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `stream` varchar(64) NOT NULL,
+  `from_paid_at` datetime(3) NOT NULL,
+  `last_paid_at` datetime(3) NOT NULL,
+  `last_txn_id` bigint(20) unsigned NOT NULL,
+  `run_id` varchar(191) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_span_stream_from` (`stream`,`from_paid_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
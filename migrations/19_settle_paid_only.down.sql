@@ -0,0 +1,2 @@
+ALTER TABLE `transactions`
+  DROP KEY `idx_status_paid_at_id`;
@@ -0,0 +1,7 @@
+-- settlement only counts paid transactions; rows stored before statuses
+-- were validated were all settled, so they are paid
+UPDATE `transactions` SET `status` = 'paid' WHERE `status` IS NULL OR `status` = '';
+
+-- keyset pagination over the paid transactions
+ALTER TABLE `transactions`
+  ADD KEY `idx_status_paid_at_id` (`status`,`paid_at`,`id`);
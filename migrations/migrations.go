@@ -0,0 +1,9 @@
+// Package migrations embeds the schema migrations so the binary can apply
+// them without the source tree. Each version is a pair of files,
+// NN_name.up.sql and NN_name.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
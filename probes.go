@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"indico-be/internal/health"
+	"indico-be/internal/job"
+)
+
+// probeTimeout bounds each check so a hung dependency fails the probe
+// instead of hanging it.
+const probeTimeout = 2 * time.Second
+
+// healthChecks builds the /livez and /readyz checks of this process.
+// Without workers (the serve role) the worker pool is not checked.
+func (a *app) healthChecks(q *job.JobQueue, withWorkers bool) (*health.Checker, error) {
+	m, err := schemaMigrator(a.db.Primary)
+	if err != nil {
+		return nil, err
+	}
+	h := health.NewChecker(probeTimeout)
+
+	// Liveness: only what a restart fixes. Taking the queue's lock shows
+	// the job system is not wedged.
+	h.Live("job_queue", func(ctx context.Context) (string, error) {
+		st := q.Workers()
+		return fmt.Sprintf("instance %s", st.Instance), nil
+	})
+
+	h.Ready("database", func(ctx context.Context) (string, error) {
+		sqlDB, err := a.db.Primary.DB()
+		if err != nil {
+			return "", err
+		}
+		if err := sqlDB.PingContext(ctx); err != nil {
+			return "", fmt.Errorf("primary: %w", err)
+		}
+		// A replica that is down is not fatal: reads fall back to the primary.
+		switch configured, healthy := a.db.ReplicaHealthy(); {
+		case !configured:
+			return "primary", nil
+		case healthy:
+			return "primary, replica healthy", nil
+		default:
+			return "primary, replica down (reads on primary)", nil
+		}
+	})
+	h.Ready("migrations", func(ctx context.Context) (string, error) {
+		return "", schemaCurrent(ctx, m)
+	})
+	h.Ready("workers", func(ctx context.Context) (string, error) {
+		if !withWorkers {
+			return "disabled (serve)", nil
+		}
+		if err := q.Running(); err != nil {
+			return "", err
+		}
+		st := q.Workers()
+		if st.Paused {
+			return fmt.Sprintf("%d workers, paused", st.Count), nil
+		}
+		return fmt.Sprintf("%d workers", st.Count), nil
+	})
+	h.Ready("export_storage", func(ctx context.Context) (string, error) {
+		return a.cfg.Export.Dir, exportWritable(a.cfg.Export.Dir)
+	})
+	return h, nil
+}
+
+// exportWritable creates and removes a file in dir, where settlement CSVs
+// and import rejects are written.
+func exportWritable(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	_, werr := f.Write([]byte("ok"))
+	cerr := f.Close()
+	rerr := os.Remove(f.Name())
+	return errors.Join(werr, cerr, rerr)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"syscall"
+
+	"indico-be/config"
+	"indico-be/internal/job"
+	"indico-be/internal/models"
+	"indico-be/internal/service"
+)
+
+// runSettle implements `go run . settle --from --to --out`: one settlement
+// job run in this process, for backfills from the shell. It is recorded in
+// job_records like a queued job, so /jobs/:id, reconciliation and webhooks
+// work for it too.
+func runSettle(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("settle", flag.ContinueOnError)
+	from := fs.String("from", "", "first day, YYYY-MM-DD (required)")
+	to := fs.String("to", "", "last day, YYYY-MM-DD (default: -from)")
+	out := fs.String("out", "", "where to write the settlement CSV (required)")
+	mode := fs.String("mode", service.ModeFull, "full or incremental")
+	stream := fs.String("stream", "", "incremental watermark stream")
+	convert := fs.Bool("convert-currency", false, "convert into the merchant's settlement currency")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *out == "" {
+		return errors.New("usage: settle --from YYYY-MM-DD [--to YYYY-MM-DD] --out PATH")
+	}
+	if *to == "" {
+		*to = *from
+	}
+
+	req, err := job.SettlementJob(*from, *to, service.RunOptions{
+		ConvertCurrency: *convert,
+		Mode:            *mode,
+		Stream:          *stream,
+	})
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	// Like a worker on shutdown: stop at the next checkpoint and leave the
+	// job INTERRUPTED, so a worker (or a rerun) can resume it.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+	go func() {
+		if sig, ok := <-quit; ok {
+			log.Printf("[settle] %s, stopping at the next checkpoint", sig)
+			cancel(job.ErrShuttingDown)
+		}
+	}()
+
+	j, res, err := a.workerPool(1).RunNow(ctx, job.DefaultClaimConfig(), req)
+	if j != nil {
+		log.Printf("[settle] job %s", j.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	src := filepath.Join(cfg.Export.Dir, path.Base(res.ResultPath))
+	if err := copyFile(src, *out); err != nil {
+		return fmt.Errorf("failed writing %s: %w", *out, err)
+	}
+	log.Printf("[settle] %s: %s written", res.Status, *out)
+	if res.Status == models.JobFinishedWithWarnings {
+		log.Printf("[settle] reconciliation found discrepancies, see GET /jobs/%s/reconciliation", j.ID)
+	}
+	return nil
+}
+
+// copyFile replaces dst with a copy of src; dst never holds a partial file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}